@@ -3,16 +3,27 @@ package api
 import (
 	"encoding/json"
 	"errors"
-	log "github.com/go-pkgz/lgr"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/metrics"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 )
 
 type Api interface {
 	GetOffers(request PageableOffersRequest) (*PageableOffers, error)
 
 	GetOffersNextPage(previousPage PageableOffers) (*PageableOffers, error)
+
+	// GetOfferDetails fetches the full investment record of the offer
+	GetOfferDetails(id int64) (*OfferDetails, error)
+
+	// GetOfferProperties fetches all properties, e.g. apartments, of the offer
+	GetOfferProperties(offerId int64) ([]Property, error)
+
+	// SearchRegions finds regions by the beginning of their name, as the site's region autocomplete does
+	SearchRegions(name string) ([]Region, error)
 }
 
 const (
@@ -40,6 +51,7 @@ type Offer struct {
 	MainImage OfferMainImage `json:"main_image"`
 	Region    OfferRegion    `json:"region"`
 	Stats     OfferStats     `json:"stats"`
+	GeoPoint  OfferGeoPoint  `json:"geo_point"`
 }
 
 type OfferVendor struct {
@@ -61,17 +73,98 @@ type OfferStats struct {
 	RangesPriceMax int64 `json:"ranges_price_max"`
 }
 
+type OfferDetails struct {
+	Id                    int64               `json:"id"`
+	Name                  string              `json:"name"`
+	Address               string              `json:"address"`
+	GeoPoint              OfferGeoPoint       `json:"geo_point"`
+	ConstructionDateRange OfferDateRange      `json:"construction_date_range"`
+	Stats                 OfferDetailsStats   `json:"stats"`
+	Facilities            []OfferFacility     `json:"facilities"`
+	Description           string              `json:"description"`
+	Vendor                OfferDetailsVendor  `json:"vendor"`
+	Gallery               []OfferGalleryImage `json:"gallery"`
+}
+
+// OfferGeoPoint is a GeoJSON point, coordinates are longitude and latitude
+type OfferGeoPoint struct {
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type OfferDateRange struct {
+	Lower string `json:"lower"`
+	Upper string `json:"upper"`
+}
+
+type OfferDetailsStats struct {
+	PropertiesCount int `json:"properties_count_for_sale"`
+}
+
+type OfferFacility struct {
+	Name string `json:"name"`
+}
+
+type OfferDetailsVendor struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type OfferGalleryImage struct {
+	Image OfferGalleryImageSizes `json:"image"`
+}
+
+type OfferGalleryImageSizes struct {
+	Image955x537 string `json:"g_img_955x537"`
+}
+
+type Property struct {
+	Id         int64   `json:"id"`
+	Number     string  `json:"number"`
+	Rooms      int     `json:"rooms"`
+	Floor      int     `json:"floor"`
+	Area       float64 `json:"area"`
+	Price      int64   `json:"price"`
+	ForSale    bool    `json:"for_sale"`
+	IsReserved bool    `json:"is_reserved"`
+}
+
+type pageableProperties struct {
+	Results []Property `json:"results"`
+	Next    string     `json:"next"`
+}
+
+type Region struct {
+	Id       int64  `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	Type     int    `json:"type"`
+}
+
+type regions struct {
+	Results []Region `json:"results"`
+}
+
 const (
+	// defaultTimeout limits a whole request including reading the body, so a stalled response doesn't hang the run
+	defaultTimeout   = 30 * time.Second
 	defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/74.0.3729.169 Safari/537.36"
 )
 
+// routes label request metrics, ids are replaced with placeholders so every offer doesn't get own series
+const (
+	offersRoute     = "/s/v2/offers/offer"
+	offerRoute      = "/s/v2/offers/offer/{id}"
+	propertiesRoute = "/s/v2/properties/property"
+	regionsRoute    = "/s/v2/regions/region"
+)
+
 type httpApi struct {
 	baseUrl    string
 	httpClient http.Client
 }
 
 func NewHttpApi(baseUrl string) Api {
-	return &httpApi{baseUrl: baseUrl, httpClient: http.Client{}}
+	return &httpApi{baseUrl: baseUrl, httpClient: http.Client{Timeout: defaultTimeout}}
 }
 
 func (api *httpApi) GetOffers(request PageableOffersRequest) (*PageableOffers, error) {
@@ -88,7 +181,7 @@ func (api *httpApi) GetOffers(request PageableOffersRequest) (*PageableOffers, e
 	queryParams.Add("sort", request.Sort)
 	queryParams.Add("type", "2")
 
-	resp, err := get(&api.httpClient, api.baseUrl+"/s/v2/offers/offer", &queryParams)
+	resp, err := get(&api.httpClient, offersRoute, api.baseUrl+"/s/v2/offers/offer", &queryParams)
 	if err != nil {
 		return nil, err
 	}
@@ -102,7 +195,7 @@ func (api *httpApi) GetOffers(request PageableOffersRequest) (*PageableOffers, e
 }
 
 func (api *httpApi) GetOffersNextPage(previousPage PageableOffers) (*PageableOffers, error) {
-	resp, err := get(&api.httpClient, previousPage.Next, nil)
+	resp, err := get(&api.httpClient, offersRoute, previousPage.Next, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -112,7 +205,76 @@ func (api *httpApi) GetOffersNextPage(previousPage PageableOffers) (*PageableOff
 	return &pageableOffers, err
 }
 
-func get(client *http.Client, urlStr string, queryParams *url.Values) (*http.Response, error) {
+func (api *httpApi) GetOfferDetails(id int64) (*OfferDetails, error) {
+	queryParams := url.Values{}
+	queryParams.Add("s", "offer-detail")
+
+	resp, err := get(&api.httpClient, offerRoute, api.baseUrl+"/s/v2/offers/offer/"+strconv.FormatInt(id, 10), &queryParams)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, errors.New("invalid response code from API")
+	}
+
+	var details OfferDetails
+	err = json.NewDecoder(resp.Body).Decode(&details)
+	return &details, err
+}
+
+func (api *httpApi) GetOfferProperties(offerId int64) ([]Property, error) {
+	queryParams := url.Values{}
+	queryParams.Add("s", "property-list")
+	queryParams.Add("offer", strconv.FormatInt(offerId, 10))
+	queryParams.Add("page_size", "100")
+
+	var properties []Property
+	pageUrl, params := api.baseUrl+"/s/v2/properties/property", &queryParams
+	for pageUrl != "" {
+		resp, err := get(&api.httpClient, propertiesRoute, pageUrl, params)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != 200 {
+			_ = resp.Body.Close()
+			return nil, errors.New("invalid response code from API")
+		}
+
+		// the body is closed on each page rather than deferred, so connections are reused across pages
+		var page pageableProperties
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		properties = append(properties, page.Results...)
+		pageUrl, params = page.Next, nil
+	}
+	return properties, nil
+}
+
+func (api *httpApi) SearchRegions(name string) ([]Region, error) {
+	queryParams := url.Values{}
+	queryParams.Add("s", "region-list")
+	queryParams.Add("name", name)
+
+	resp, err := get(&api.httpClient, regionsRoute, api.baseUrl+"/s/v2/regions/region", &queryParams)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, errors.New("invalid response code from API")
+	}
+
+	var found regions
+	err = json.NewDecoder(resp.Body).Decode(&found)
+	return found.Results, err
+}
+
+// get requests the url, route labels the request metrics
+func get(client *http.Client, route string, urlStr string, queryParams *url.Values) (*http.Response, error) {
 	u, err := url.Parse(urlStr)
 	if err != nil {
 		return nil, err
@@ -129,6 +291,22 @@ func get(client *http.Client, urlStr string, queryParams *url.Values) (*http.Res
 
 	req.Header.Add("User-Agent", defaultUserAgent)
 
-	log.Printf("[DEBUG] GET %v ", requestUrl)
-	return client.Do(req)
+	logger := logging.With(logging.Fields{"stage": "api", "path": u.Path})
+	logger.Printf("[DEBUG] GET %v ", requestUrl)
+
+	started := time.Now()
+	resp, err := client.Do(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	metrics.ObserveApiRequest(route, status, started)
+
+	logger = logger.With(logging.Fields{"status": status, "duration": time.Since(started)})
+	if err != nil {
+		logger.With(logging.Fields{"error": err}).Printf("[WARN] GET %v failed", requestUrl)
+		return resp, err
+	}
+	logger.Printf("[DEBUG] GET %v responded", requestUrl)
+	return resp, nil
 }
@@ -2,10 +2,12 @@ package api
 
 import (
 	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -42,3 +44,100 @@ func TestHttpApi_GetOffers(t *testing.T) {
 
 	assert.Equal(t, resp, expected)
 }
+
+func TestHttpApi_SearchRegions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/s/v2/regions/region", r.URL.Path)
+		assert.Equal(t, "region-list", r.URL.Query().Get("s"))
+		assert.Equal(t, "krak", r.URL.Query().Get("name"))
+		_, _ = fmt.Fprint(w, "{\"results\":["+
+			"{\"id\":52258,\"name\":\"Kraków\",\"full_name\":\"małopolskie, Kraków\",\"type\":4},"+
+			"{\"id\":8647,\"name\":\"Krakowiany\",\"full_name\":\"dolnośląskie, wrocławski, Siechnice, Krakowiany\",\"type\":7}]}")
+	}))
+	defer server.Close()
+	api := NewHttpApi(server.URL)
+
+	found, err := api.SearchRegions("krak")
+
+	require.NoError(t, err)
+	assert.Equal(t, []Region{
+		{Id: 52258, Name: "Kraków", FullName: "małopolskie, Kraków", Type: 4},
+		{Id: 8647, Name: "Krakowiany", FullName: "dolnośląskie, wrocławski, Siechnice, Krakowiany", Type: 7},
+	}, found)
+}
+
+func TestHttpApi_GetOfferDetails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/s/v2/offers/offer/1", r.URL.Path)
+		assert.Equal(t, "offer-detail", r.URL.Query().Get("s"))
+		_, _ = fmt.Fprint(w, "{\"id\":1,\"name\":\"Wille Acme\",\"address\":\"ul. Zielona 1\","+
+			"\"geo_point\":{\"type\":\"Point\",\"coordinates\":[19.89,50.08]},"+
+			"\"construction_date_range\":{\"lower\":\"2021-03-01\",\"upper\":\"2022-12-31\"},"+
+			"\"stats\":{\"properties_count_for_sale\":12},"+
+			"\"facilities\":[{\"name\":\"garaż\"}],"+
+			"\"description\":\"Kameralna inwestycja\","+
+			"\"vendor\":{\"name\":\"Bar Sp. z o.o.\",\"slug\":\"bar-sp-z-oo\"},"+
+			"\"gallery\":[{\"image\":{\"g_img_955x537\":\"https://example.com/g1.jpg\"}}]}")
+	}))
+	defer server.Close()
+	api := NewHttpApi(server.URL)
+
+	details, err := api.GetOfferDetails(1)
+
+	require.NoError(t, err)
+	assert.Equal(t, &OfferDetails{
+		Id:                    1,
+		Name:                  "Wille Acme",
+		Address:               "ul. Zielona 1",
+		GeoPoint:              OfferGeoPoint{Coordinates: []float64{19.89, 50.08}},
+		ConstructionDateRange: OfferDateRange{Lower: "2021-03-01", Upper: "2022-12-31"},
+		Stats:                 OfferDetailsStats{PropertiesCount: 12},
+		Facilities:            []OfferFacility{{Name: "garaż"}},
+		Description:           "Kameralna inwestycja",
+		Vendor:                OfferDetailsVendor{Name: "Bar Sp. z o.o.", Slug: "bar-sp-z-oo"},
+		Gallery:               []OfferGalleryImage{{Image: OfferGalleryImageSizes{Image955x537: "https://example.com/g1.jpg"}}},
+	}, details)
+}
+
+func TestHttpApi_GetOfferDetails_Metrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{}")
+	}))
+	defer server.Close()
+	api := NewHttpApi(server.URL)
+
+	_, err := api.GetOfferDetails(1)
+	require.NoError(t, err)
+	_, err = api.GetOfferDetails(2)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	assert.Contains(t, body, "rynek_pierwotny_api_request_duration_seconds_count{path=\"/s/v2/offers/offer/{id}\",status=\"200\"}")
+	assert.False(t, strings.Contains(body, "/s/v2/offers/offer/1"), "offer ids are not used as labels")
+}
+
+func TestHttpApi_GetOfferProperties(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/s/v2/properties/property", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("offer"))
+		if r.URL.Query().Get("page") == "2" {
+			_, _ = fmt.Fprint(w, "{\"results\":[{\"id\":12,\"rooms\":2,\"floor\":3,\"area\":41.5,\"price\":520000,\"for_sale\":false}],\"next\":null}")
+			return
+		}
+		_, _ = fmt.Fprintf(w, "{\"results\":[{\"id\":11,\"number\":\"A1\",\"rooms\":3,\"floor\":1,\"area\":62,\"price\":780000,\"for_sale\":true,\"is_reserved\":true}],"+
+			"\"next\":\"%s/s/v2/properties/property?offer=1&page=2\"}", server.URL)
+	}))
+	defer server.Close()
+	api := NewHttpApi(server.URL)
+
+	properties, err := api.GetOfferProperties(1)
+
+	require.NoError(t, err)
+	assert.Equal(t, []Property{
+		{Id: 11, Number: "A1", Rooms: 3, Floor: 1, Area: 62, Price: 780000, ForSale: true, IsReserved: true},
+		{Id: 12, Rooms: 2, Floor: 3, Area: 41.5, Price: 520000},
+	}, properties)
+}
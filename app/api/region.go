@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ResolveRegion returns id of the region referenced by numeric id or by name. A name has to match name or full name
+// of exactly one found region, case is ignored.
+func ResolveRegion(api Api, ref string) (int64, error) {
+	ref = strings.TrimSpace(ref)
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return id, nil
+	}
+
+	found, err := api.SearchRegions(ref)
+	if err != nil {
+		return 0, err
+	}
+
+	var matched []Region
+	for _, r := range found {
+		if strings.EqualFold(r.Name, ref) || strings.EqualFold(r.FullName, ref) {
+			matched = append(matched, r)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return 0, fmt.Errorf("region %q not found", ref)
+	case 1:
+		return matched[0].Id, nil
+	default:
+		names := make([]string, 0, len(matched))
+		for _, r := range matched {
+			names = append(names, fmt.Sprintf("%d (%s)", r.Id, r.FullName))
+		}
+		return 0, fmt.Errorf("region %q is ambiguous, use one of ids: %s", ref, strings.Join(names, ", "))
+	}
+}
+
+// ResolveRegions resolves all referenced regions
+func ResolveRegions(api Api, refs []string) ([]int64, error) {
+	ids := make([]int64, 0, len(refs))
+	for _, ref := range refs {
+		id, err := ResolveRegion(api, ref)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveRegions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":["+
+			"{\"id\":52258,\"name\":\"Kraków\",\"full_name\":\"małopolskie, Kraków\",\"type\":4},"+
+			"{\"id\":8647,\"name\":\"Krakowiany\",\"full_name\":\"dolnośląskie, wrocławski, Siechnice, Krakowiany\",\"type\":7},"+
+			"{\"id\":1,\"name\":\"Nowa Wieś\",\"full_name\":\"mazowieckie, Nowa Wieś\",\"type\":7},"+
+			"{\"id\":2,\"name\":\"Nowa Wieś\",\"full_name\":\"podlaskie, Nowa Wieś\",\"type\":7}]}")
+	}))
+	defer server.Close()
+	api := NewHttpApi(server.URL)
+
+	ids, err := ResolveRegions(api, []string{"120", "kraków", "podlaskie, Nowa Wieś"})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{120, 52258, 2}, ids)
+
+	_, err = ResolveRegion(api, "Nowa Wieś")
+	assert.EqualError(t, err, "region \"Nowa Wieś\" is ambiguous, use one of ids: 1 (mazowieckie, Nowa Wieś), 2 (podlaskie, Nowa Wieś)")
+
+	_, err = ResolveRegion(api, "Krak")
+	assert.EqualError(t, err, "region \"Krak\" not found")
+}
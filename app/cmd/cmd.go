@@ -1,12 +1,16 @@
 package cmd
 
 import (
+	"errors"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/api"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/filter"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/health"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/media"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/util"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/writer"
 	log "github.com/go-pkgz/lgr"
-	"net/http"
 	"os"
 )
 
@@ -20,18 +24,72 @@ type CommonOpts struct {
 	PrimaryMarketURL string
 	PrimaryMarketAPI api.Api
 	OfferStore       store.OfferStore
+	PropertyStore    store.PropertyStore
 	OfferWriter      writer.MessageWriter
 	Clock            util.Clock
-	HttpClient       http.Client
+	ImageFetcher     media.Fetcher
+	Health           *health.Monitor
+	// Snapshot saves records of the memory engine after every run, nil when the engine persists records on write
+	Snapshot func() error
+	// PruneImages removes expired cached images after every run, nil when cached images don't expire
+	PruneImages func() error
+	// Profiles are named sets of regions, filter, writer and store configured in config file
+	Profiles []Profile
+}
+
+// Profile is a named set of regions and filter the command runs for, notifying with own writer and tracking
+// offers in own store
+type Profile struct {
+	Name          string
+	Regions       []int64
+	Filter        filter.Options
+	OfferWriter   writer.MessageWriter
+	OfferStore    store.OfferStore
+	PropertyStore store.PropertyStore
 }
 
 func (c *CommonOpts) SetCommon(commonOpts CommonOpts) {
 	c.PrimaryMarketURL = commonOpts.PrimaryMarketURL
 	c.PrimaryMarketAPI = commonOpts.PrimaryMarketAPI
 	c.OfferStore = commonOpts.OfferStore
+	c.PropertyStore = commonOpts.PropertyStore
 	c.OfferWriter = commonOpts.OfferWriter
 	c.Clock = commonOpts.Clock
-	c.HttpClient = commonOpts.HttpClient
+	c.ImageFetcher = commonOpts.ImageFetcher
+	c.Health = commonOpts.Health
+	c.Snapshot = commonOpts.Snapshot
+	c.PruneImages = commonOpts.PruneImages
+	c.Profiles = commonOpts.Profiles
+}
+
+// walkOffers calls fn for every stored offer, corrupted records are logged and skipped so a single broken record
+// doesn't hide all the others. Returns the number of skipped records.
+func walkOffers(offerStore store.OfferStore, stage string, fn func(offer store.Offer) error) (int, error) {
+	skipped := 0
+	err := offerStore.Walk(func(offer store.Offer, err error) error {
+		var corrupted *store.CorruptedRecordError
+		if errors.As(err, &corrupted) {
+			logging.With(logging.Fields{"stage": stage, "path": corrupted.Path, "error": corrupted.Err}).
+				Printf("[WARN] Stored offer %v is corrupted, skipped it", corrupted.Path)
+			skipped++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(offer)
+	})
+	return skipped, err
+}
+
+// listOffers returns all stored offers skipping corrupted records, see walkOffers
+func listOffers(offerStore store.OfferStore, stage string) ([]store.Offer, error) {
+	var offers []store.Offer
+	_, err := walkOffers(offerStore, stage, func(offer store.Offer) error {
+		offers = append(offers, offer)
+		return nil
+	})
+	return offers, err
 }
 
 // resetEnv clears sensitive env vars
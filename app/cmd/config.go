@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/config"
+	"io"
+	"os"
+)
+
+// ConfigCommander is implemented by commands working with the configuration file instead of offers
+type ConfigCommander interface {
+	SetConfig(cfg *config.Config)
+
+	Execute(args []string) error
+}
+
+type ConfigCommand struct {
+	Validate ConfigValidateCommand `command:"validate" description:"validate configuration file"`
+}
+
+// ConfigValidateCommand validates configuration file passed with --config. Options of the file are checked
+// when the file is applied, before the command runs.
+type ConfigValidateCommand struct {
+	cfg *config.Config
+	// out receives validation result, stdout when not set
+	out io.Writer
+}
+
+func (c *ConfigValidateCommand) SetConfig(cfg *config.Config) {
+	c.cfg = cfg
+}
+
+func (c *ConfigValidateCommand) Execute(_ []string) error {
+	if c.cfg == nil {
+		return ConfigError(errors.New("no config file, use --config"))
+	}
+	if err := c.cfg.Validate(); err != nil {
+		return ConfigError(err)
+	}
+
+	out := c.out
+	if out == nil {
+		out = os.Stdout
+	}
+	_, err := fmt.Fprintf(out, "%s is valid: %d options, %d profiles\n", c.cfg.Path, len(c.cfg.Options), len(c.cfg.Profiles))
+	return err
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/api"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"strconv"
+	"strings"
+)
+
+// fetchDetails fetches the full investment record of the offer, returns nil when it is not available
+func (cmd *OffersUpdatesCommand) fetchDetails(offer store.Offer) *store.OfferDetails {
+	logger := logging.With(logging.Fields{"stage": "notify", "offer_id": offer.Id})
+	logger.Printf("[DEBUG] Getting details of offer id %v..", offer.Id)
+
+	details, err := cmd.PrimaryMarketAPI.GetOfferDetails(offer.Id)
+	if err != nil {
+		logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't get details of offer id %v, skipping them", offer.Id)
+		return nil
+	}
+	return cmd.mapApiOfferDetails(*details)
+}
+
+// mapApiOfferDetails maps to domain struct
+func (cmd *OffersUpdatesCommand) mapApiOfferDetails(details api.OfferDetails) *store.OfferDetails {
+	result := store.OfferDetails{
+		Address:           details.Address,
+		ConstructionStart: details.ConstructionDateRange.Lower,
+		ConstructionEnd:   details.ConstructionDateRange.Upper,
+		PropertiesCount:   details.Stats.PropertiesCount,
+		Description:       details.Description,
+		VendorName:        details.Vendor.Name,
+		FetchedAt:         cmd.Clock.Now(),
+	}
+	if len(details.GeoPoint.Coordinates) == 2 {
+		result.Longitude = details.GeoPoint.Coordinates[0]
+		result.Latitude = details.GeoPoint.Coordinates[1]
+	}
+	for _, f := range details.Facilities {
+		result.Amenities = append(result.Amenities, f.Name)
+	}
+	for _, g := range details.Gallery {
+		result.Gallery = append(result.Gallery, g.Image.Image955x537)
+	}
+	return &result
+}
+
+// detailsText formats investment details of a new offer notification
+func detailsText(details *store.OfferDetails) string {
+	txt := ""
+	if details.Address != "" {
+		txt = txt + "📌 " + details.Address + "\n"
+	}
+	if details.VendorName != "" {
+		txt = txt + "🏗 " + details.VendorName + "\n"
+	}
+	if details.ConstructionEnd != "" {
+		txt = txt + "🗓 " + details.ConstructionEnd + "\n"
+	}
+	if details.PropertiesCount > 0 {
+		txt = txt + "🔑 " + strconv.Itoa(details.PropertiesCount) + "\n"
+	}
+	if len(details.Amenities) > 0 {
+		txt = txt + "✨ " + strings.Join(details.Amenities, ", ") + "\n"
+	}
+	return txt
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/writer"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Dry run report formats
+const (
+	DryRunFormatText = "text"
+	DryRunFormatJson = "json"
+)
+
+// dryRunReport collects messages which would be sent and offers which would be saved during a dry run
+type dryRunReport struct {
+	Profile  string          `json:"profile,omitempty"`
+	Messages []dryRunMessage `json:"messages"`
+	Saved    []store.Offer   `json:"saved"`
+
+	lock sync.Mutex
+}
+
+type dryRunMessage struct {
+	Title    string `json:"title,omitempty"`
+	ImageUrl string `json:"image_url,omitempty"`
+	Text     string `json:"text"`
+	ReplyTo  string `json:"reply_to,omitempty"`
+}
+
+// dryRunWriter records messages instead of sending them, images are passed by url so they are not downloaded
+type dryRunWriter struct {
+	report *dryRunReport
+}
+
+func (w *dryRunWriter) Write(message writer.Message) (string, error) {
+	w.report.lock.Lock()
+	defer w.report.lock.Unlock()
+
+	w.report.Messages = append(w.report.Messages, dryRunMessage{
+		Title:    message.Title,
+		ImageUrl: message.ImageUrl,
+		Text:     message.Text,
+		ReplyTo:  message.ReplyTo,
+	})
+	return "dry-run-" + strconv.Itoa(len(w.report.Messages)), nil
+}
+
+func (w *dryRunWriter) AcceptsImageUrl() bool {
+	return true
+}
+
+// dryRunStore reads offers from the underlying store and records saved offers without persisting them
+type dryRunStore struct {
+	store.OfferStore
+	report *dryRunReport
+}
+
+func (s *dryRunStore) Save(offer store.Offer) error {
+	s.report.lock.Lock()
+	defer s.report.lock.Unlock()
+
+	s.report.Saved = append(s.report.Saved, offer)
+	return nil
+}
+
+func (s *dryRunStore) Quarantine(_ int64) error {
+	return nil
+}
+
+// dryRunPropertyStore reads properties from the underlying store and skips saving them
+type dryRunPropertyStore struct {
+	store.PropertyStore
+}
+
+func (s *dryRunPropertyStore) Save(_ int64, _ []store.Property) error {
+	return nil
+}
+
+// print writes the report in the format
+func (r *dryRunReport) print(out io.Writer, format string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if format == DryRunFormatJson {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	var sb strings.Builder
+	if r.Profile != "" {
+		_, _ = fmt.Fprintf(&sb, "Profile %s\n", r.Profile)
+	}
+	_, _ = fmt.Fprintf(&sb, "Would send %d messages:\n", len(r.Messages))
+	for i, m := range r.Messages {
+		_, _ = fmt.Fprintf(&sb, "\n--- message %d", i+1)
+		if m.ReplyTo != "" {
+			_, _ = fmt.Fprintf(&sb, " (reply to %s)", m.ReplyTo)
+		}
+		sb.WriteString(" ---\n")
+		if m.ImageUrl != "" {
+			_, _ = fmt.Fprintf(&sb, "[image %s]\n", m.ImageUrl)
+		}
+		sb.WriteString(m.Text + "\n")
+	}
+	_, _ = fmt.Fprintf(&sb, "\nWould save %d offers:\n", len(r.Saved))
+	for _, o := range r.Saved {
+		_, _ = fmt.Fprintf(&sb, "%d %s %d-%d %s\n", o.Id, o.Name, o.PriceMin, o.PriceMax, o.Link)
+	}
+	_, err := io.WriteString(out, sb.String())
+	return err
+}
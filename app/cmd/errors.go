@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/multierr"
+	"sync/atomic"
+)
+
+// Exit codes the process finishes with depending on the kind of the failure
+const (
+	ExitOk           = 0
+	ExitFailure      = 1
+	ExitConfig       = 2
+	ExitApi          = 3
+	ExitStorage      = 4
+	ExitAborted      = 5
+	ExitNotification = 6
+)
+
+// ErrorKind tells which part of the run failed
+type ErrorKind string
+
+const (
+	KindConfig       ErrorKind = "config"
+	KindApi          ErrorKind = "api"
+	KindStorage      ErrorKind = "storage"
+	KindNotification ErrorKind = "notification"
+	KindAborted      ErrorKind = "aborted"
+)
+
+// Fail-on policies deciding which failures make the command fail
+const (
+	FailOnAny     = "any"
+	FailOnApi     = "api"
+	FailOnStorage = "storage"
+	FailOnNone    = "none"
+)
+
+// exitCodes lists kinds by priority, the first kind found among run errors determines the exit code
+var exitCodes = []struct {
+	kind ErrorKind
+	code int
+}{
+	{KindConfig, ExitConfig},
+	{KindApi, ExitApi},
+	{KindStorage, ExitStorage},
+	{KindAborted, ExitAborted},
+	{KindNotification, ExitNotification},
+}
+
+// Error is a failure of the specified kind
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return string(e.Kind) + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError marks an error as a configuration one
+func ConfigError(err error) error {
+	return kindError(KindConfig, err)
+}
+
+func kindError(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// hasKind reports whether any of aggregated errors is of the kind
+func hasKind(err error, kind ErrorKind) bool {
+	for _, e := range multierr.Errors(err) {
+		var kindErr *Error
+		if errors.As(e, &kindErr) && kindErr.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ExitCode maps an error, possibly aggregating several ones, to the process exit code
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOk
+	}
+	for _, c := range exitCodes {
+		if hasKind(err, c.kind) {
+			return c.code
+		}
+	}
+	return ExitFailure
+}
+
+// applyFailOn drops errors the fail-on policy does not fail on, config errors and an aborted run fail
+// on any policy but none
+func applyFailOn(policy string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var failing []error
+	for _, e := range multierr.Errors(err) {
+		if failsOn(policy, e) {
+			failing = append(failing, e)
+		}
+	}
+	return multierr.Combine(failing...)
+}
+
+func failsOn(policy string, err error) bool {
+	switch policy {
+	case FailOnNone:
+		return false
+	case FailOnApi:
+		return hasKind(err, KindApi) || hasKind(err, KindConfig) || hasKind(err, KindAborted)
+	case FailOnStorage:
+		return hasKind(err, KindStorage) || hasKind(err, KindConfig) || hasKind(err, KindAborted)
+	default:
+		return true
+	}
+}
+
+// failureThreshold aborts a run when the ratio of failed offers to processed ones exceeds the limit,
+// the ratio is checked only after minOffers offers were processed so a single early failure does not abort the run
+type failureThreshold struct {
+	ratio     float64
+	minOffers int64
+
+	processed int64
+	failed    int64
+	aborted   int32
+}
+
+func newFailureThreshold(ratio float64, minOffers int) *failureThreshold {
+	return &failureThreshold{ratio: ratio, minOffers: int64(minOffers)}
+}
+
+func (t *failureThreshold) offerProcessed() {
+	atomic.AddInt64(&t.processed, 1)
+}
+
+// offerFailed records a failed offer and returns an error when it makes the run exceed the threshold,
+// the error is returned only once per run
+func (t *failureThreshold) offerFailed() error {
+	failed := atomic.AddInt64(&t.failed, 1)
+	processed := atomic.LoadInt64(&t.processed)
+	if t.ratio <= 0 || processed < t.minOffers || processed == 0 {
+		return nil
+	}
+	if float64(failed)/float64(processed) <= t.ratio {
+		return nil
+	}
+	if !atomic.CompareAndSwapInt32(&t.aborted, 0, 1) {
+		return nil
+	}
+	return kindError(KindAborted, fmt.Errorf("%d of %d processed offers failed, exceeding %.0f%% threshold", failed, processed, t.ratio*100))
+}
+
+// exceeded reports whether the run was aborted
+func (t *failureThreshold) exceeded() bool {
+	return atomic.LoadInt32(&t.aborted) == 1
+}
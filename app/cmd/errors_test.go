@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/multierr"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tbl := []struct {
+		err  error
+		code int
+	}{
+		{nil, ExitOk},
+		{errors.New("unknown"), ExitFailure},
+		{ConfigError(errors.New("bad option")), ExitConfig},
+		{kindError(KindNotification, errors.New("telegram down")), ExitNotification},
+		{multierr.Combine(
+			kindError(KindNotification, errors.New("telegram down")),
+			kindError(KindStorage, errors.New("bucket not available")),
+		), ExitStorage},
+		{multierr.Combine(
+			kindError(KindStorage, errors.New("bucket not available")),
+			kindError(KindApi, errors.New("api down")),
+			kindError(KindAborted, errors.New("too many failures")),
+		), ExitApi},
+	}
+
+	for _, tt := range tbl {
+		assert.Equal(t, tt.code, ExitCode(tt.err), "%v", tt.err)
+	}
+}
+
+func TestApplyFailOn(t *testing.T) {
+	apiErr := kindError(KindApi, errors.New("api down"))
+	storageErr := kindError(KindStorage, errors.New("bucket not available"))
+	notificationErr := kindError(KindNotification, errors.New("telegram down"))
+	err := multierr.Combine(apiErr, storageErr, notificationErr)
+
+	assert.Equal(t, err, applyFailOn(FailOnAny, err))
+	assert.Equal(t, apiErr, applyFailOn(FailOnApi, err))
+	assert.Equal(t, storageErr, applyFailOn(FailOnStorage, err))
+	assert.NoError(t, applyFailOn(FailOnNone, err))
+	assert.NoError(t, applyFailOn(FailOnApi, notificationErr))
+	assert.NoError(t, applyFailOn(FailOnAny, nil))
+}
+
+func TestFailureThreshold(t *testing.T) {
+	threshold := newFailureThreshold(0.2, 5)
+	for i := 0; i < 4; i++ {
+		threshold.offerProcessed()
+	}
+	assert.NoError(t, threshold.offerFailed(), "not enough offers processed")
+
+	for i := 0; i < 6; i++ {
+		threshold.offerProcessed()
+	}
+	assert.NoError(t, threshold.offerFailed(), "2 of 10 does not exceed the ratio")
+	assert.False(t, threshold.exceeded())
+
+	err := threshold.offerFailed()
+	assert.Equal(t, ExitAborted, ExitCode(err))
+	assert.True(t, threshold.exceeded())
+	assert.NoError(t, threshold.offerFailed(), "abort is reported once")
+}
+
+func TestFailureThreshold_Disabled(t *testing.T) {
+	threshold := newFailureThreshold(0, 0)
+	threshold.offerProcessed()
+
+	assert.NoError(t, threshold.offerFailed())
+	assert.False(t, threshold.exceeded())
+}
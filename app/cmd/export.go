@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/export"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/filter"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"go.uber.org/multierr"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// dateLayout is the format of dates in command options
+const dateLayout = "2006-01-02"
+
+// StdoutCommander writes data to stdout, so logs are written to stderr not to be mixed with data
+type StdoutCommander interface {
+	WritesStdout() bool
+
+	Execute(args []string) error
+}
+
+// ExportCommand writes stored offers to a file for analysis in other tools
+type ExportCommand struct {
+	Format       string         `long:"format" env:"FORMAT" choice:"csv" choice:"jsonl" choice:"parquet" default:"csv" description:"export format"`
+	Output       string         `short:"o" long:"output" env:"OUTPUT" description:"file offers are written to, stdout when not set"`
+	Columns      []string       `long:"columns" env:"COLUMNS" env-delim:"," description:"comma separated columns to export, all columns when not set"`
+	Regions      []string       `long:"region" env:"REGIONS" env-delim:";" description:"export offers whose region name contains the text, case insensitive"`
+	ImportedFrom string         `long:"imported-from" env:"IMPORTED_FROM" description:"export offers imported on the date or later, format YYYY-MM-DD"`
+	ImportedTo   string         `long:"imported-to" env:"IMPORTED_TO" description:"export offers imported on the date or earlier, format YYYY-MM-DD"`
+	Profile      string         `long:"profile" env:"PROFILE" description:"export offers of the config file profile, offers of runs without profiles when not set"`
+	Filter       filter.Options `group:"filter" namespace:"filter" env-namespace:"FILTER"`
+
+	engine engine.Engine
+	// out receives exported offers when output file is not set, stdout when not set
+	out io.Writer
+}
+
+func (c *ExportCommand) SetEngine(eng engine.Engine) {
+	c.engine = eng
+}
+
+// WritesStdout reports offers are exported to stdout
+func (c *ExportCommand) WritesStdout() bool {
+	return c.Output == ""
+}
+
+func (c *ExportCommand) Execute(_ []string) (err error) {
+	from, to, err := c.importedRange()
+	if err != nil {
+		return ConfigError(err)
+	}
+	if err := c.Filter.Validate(); err != nil {
+		return ConfigError(err)
+	}
+
+	out := c.out
+	if out == nil {
+		out = os.Stdout
+	}
+	if c.Output != "" {
+		f, err := os.Create(c.Output)
+		if err != nil {
+			return kindError(KindStorage, err)
+		}
+		defer func() {
+			err = multierr.Append(err, f.Close())
+		}()
+		out = f
+	}
+
+	w, err := export.NewWriter(c.Format, out, c.columns())
+	if err != nil {
+		return ConfigError(err)
+	}
+
+	offerStore := store.NewOfferFileStore(c.engine)
+	if c.Profile != "" {
+		offerStore = store.NewPrefixedOfferFileStore(c.engine, ProfilePrefix(c.Profile))
+	}
+
+	exported := 0
+	skipped, err := walkOffers(offerStore, "export", func(offer store.Offer) error {
+		if !c.accepts(offer, from, to) {
+			return nil
+		}
+		exported++
+		return w.Write(offer)
+	})
+	if err != nil {
+		return kindError(KindStorage, err)
+	}
+	if err := w.Close(); err != nil {
+		return kindError(KindStorage, err)
+	}
+	logging.With(logging.Fields{"stage": "export", "skipped_corrupted": skipped}).Printf("[INFO] Exported %d offers", exported)
+	return nil
+}
+
+// columns splits comma separated column names, so columns can be passed in a single flag
+func (c *ExportCommand) columns() []string {
+	var names []string
+	for _, value := range c.Columns {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// importedRange parses import dates, zero times are not applied and the end is exclusive
+func (c *ExportCommand) importedRange() (from time.Time, to time.Time, err error) {
+	if c.ImportedFrom != "" {
+		if from, err = time.Parse(dateLayout, c.ImportedFrom); err != nil {
+			return from, to, fmt.Errorf("invalid imported from date: %w", err)
+		}
+	}
+	if c.ImportedTo != "" {
+		if to, err = time.Parse(dateLayout, c.ImportedTo); err != nil {
+			return from, to, fmt.Errorf("invalid imported to date: %w", err)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, errors.New("imported from date is after imported to date")
+	}
+	return from, to, nil
+}
+
+func (c *ExportCommand) accepts(offer store.Offer, from time.Time, to time.Time) bool {
+	if !from.IsZero() && offer.ImportedAt.Before(from) {
+		return false
+	}
+	if !to.IsZero() && !offer.ImportedAt.Before(to) {
+		return false
+	}
+	if len(c.Regions) > 0 {
+		found := false
+		for _, r := range c.Regions {
+			found = found || strings.Contains(strings.ToLower(offer.RegionName), strings.ToLower(r))
+		}
+		if !found {
+			return false
+		}
+	}
+	return c.Filter.Accepts(offer)
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/umputun/go-flags"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportCommand_Execute(t *testing.T) {
+	eng := memory.NewEngine()
+	offerStore := store.NewOfferFileStore(eng)
+	august := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	september := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, offerStore.Save(store.Offer{Id: 1, Name: "Wille Acme", RegionName: "małopolskie, Kraków, Bronowice", ImportedAt: august, PriceMin: 500000, PriceMax: 900000}))
+	require.NoError(t, offerStore.Save(store.Offer{Id: 2, Name: "Foo Acme", RegionName: "małopolskie, Kraków, Podgórze", ImportedAt: september, PriceMin: 1500000}))
+	require.NoError(t, offerStore.Save(store.Offer{Id: 3, Name: "Bar Acme", RegionName: "małopolskie, Wieliczka", ImportedAt: september, PriceMin: 400000}))
+	require.NoError(t, offerStore.Save(store.Offer{Id: 4, Name: "Baz Acme", RegionName: "mazowieckie, Warszawa", ImportedAt: september}))
+	require.NoError(t, store.NewPrefixedOfferFileStore(eng, ProfilePrefix("krakow")).Save(store.Offer{Id: 5, Name: "Profile Acme", RegionName: "małopolskie, Kraków", ImportedAt: september}))
+
+	tbl := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--columns=id,name"}, "id,name\n1,Wille Acme\n2,Foo Acme\n3,Bar Acme\n4,Baz Acme\n"},
+		{[]string{"--columns=id", "--region=KRAKÓW", "--region=wieliczka"}, "id\n1\n2\n3\n"},
+		{[]string{"--columns=id", "--imported-from=2026-09-01", "--imported-to=2026-09-01"}, "id\n2\n3\n4\n"},
+		{[]string{"--columns=id", "--imported-to=2026-08-31"}, "id\n1\n"},
+		{[]string{"--columns=id", "--filter.price-max=1000000"}, "id\n1\n3\n4\n"},
+		{[]string{"--columns=id", "--columns=region_name", "--profile=krakow", "--format=jsonl"}, "{\"id\":5,\"region_name\":\"małopolskie, Kraków\"}\n"},
+	}
+	for _, tt := range tbl {
+		cmd := ExportCommand{}
+		cmd.SetEngine(eng)
+		var out bytes.Buffer
+		cmd.out = &out
+		_, err := flags.NewParser(&cmd, flags.Default).ParseArgs(tt.args)
+		require.NoError(t, err)
+
+		err = cmd.Execute(nil)
+		require.NoError(t, err, "%v", tt.args)
+		assert.Equal(t, tt.expected, out.String(), "%v", tt.args)
+	}
+}
+
+func TestExportCommand_Execute_Output(t *testing.T) {
+	eng := memory.NewEngine()
+	require.NoError(t, store.NewOfferFileStore(eng).Save(store.Offer{Id: 1, Name: "Wille Acme"}))
+
+	output := filepath.Join(t.TempDir(), "offers.jsonl")
+	cmd := ExportCommand{}
+	cmd.SetEngine(eng)
+	_, err := flags.NewParser(&cmd, flags.Default).ParseArgs([]string{"--format=jsonl", "--columns=id,name", "-o", output})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	b, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "{\"id\":1,\"name\":\"Wille Acme\"}\n", string(b))
+}
+
+func TestExportCommand_Execute_Corrupted(t *testing.T) {
+	eng := memory.NewEngine()
+	require.NoError(t, store.NewOfferFileStore(eng).Save(store.Offer{Id: 1, Name: "Wille Acme"}))
+	require.NoError(t, eng.Write("2.json", []byte(`{"id":2,`)))
+	require.NoError(t, store.NewOfferFileStore(eng).Save(store.Offer{Id: 3, Name: "Bar Acme"}))
+
+	cmd := ExportCommand{}
+	cmd.SetEngine(eng)
+	var out bytes.Buffer
+	cmd.out = &out
+	_, err := flags.NewParser(&cmd, flags.Default).ParseArgs([]string{"--columns=id,name"})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err, "corrupted record is skipped")
+	assert.Equal(t, "id,name\n1,Wille Acme\n3,Bar Acme\n", out.String())
+}
+
+func TestExportCommand_Execute_InvalidOptions(t *testing.T) {
+	for _, args := range [][]string{
+		{"--columns=id,price"},
+		{"--imported-from=01.09.2026"},
+		{"--imported-from=2026-09-02", "--imported-to=2026-09-01"},
+		{"--filter.price-min=2", "--filter.price-max=1"},
+	} {
+		cmd := ExportCommand{}
+		cmd.SetEngine(memory.NewEngine())
+		cmd.out = &bytes.Buffer{}
+		_, err := flags.NewParser(&cmd, flags.Default).ParseArgs(args)
+		require.NoError(t, err)
+
+		err = cmd.Execute(nil)
+		assert.Equal(t, ExitConfig, ExitCode(err), "%v", args)
+	}
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"io"
+	"os"
+	"sort"
+)
+
+// EngineOpenerCommander is implemented by commands which open engines described by urls
+type EngineOpenerCommander interface {
+	SetEngineOpener(open func(url string) (engine.Engine, error))
+
+	Execute(args []string) error
+}
+
+// MigrateCommand copies all records between engines. Records already copied with the same content are skipped,
+// so an interrupted migration continues where it stopped when run again.
+type MigrateCommand struct {
+	From      string `long:"from" env:"FROM" required:"true" description:"source engine url, e.g. file:///var/lib/state or s3://bucket?region=eu-west-1"`
+	To        string `long:"to" env:"TO" required:"true" description:"target engine url"`
+	Overwrite bool   `long:"overwrite" env:"OVERWRITE" description:"replace target records with different content instead of failing"`
+
+	open func(url string) (engine.Engine, error)
+	// out receives the migration report, stdout when not set
+	out io.Writer
+}
+
+// migration counts records of a migration and keeps checksums of source records to verify target ones with
+type migration struct {
+	Records     int
+	Copied      int
+	Skipped     int
+	Overwritten int
+	Conflicts   []string
+
+	checksums map[string][sha256.Size]byte
+}
+
+func (c *MigrateCommand) SetEngineOpener(open func(url string) (engine.Engine, error)) {
+	c.open = open
+}
+
+func (c *MigrateCommand) Execute(_ []string) error {
+	if c.From == c.To {
+		return ConfigError(errors.New("source and target engines are the same"))
+	}
+	from, err := c.open(c.From)
+	if err != nil {
+		return ConfigError(fmt.Errorf("can't open source engine: %w", err))
+	}
+	to, err := c.open(c.To)
+	if err != nil {
+		return ConfigError(fmt.Errorf("can't open target engine: %w", err))
+	}
+
+	paths, err := from.List("")
+	if err != nil {
+		return kindError(KindStorage, fmt.Errorf("can't list source records: %w", err))
+	}
+	sort.Strings(paths)
+
+	logger := logging.With(logging.Fields{"stage": "migrate"})
+	logger.Printf("[INFO] Migrating %d records..", len(paths))
+
+	m := migration{Records: len(paths), checksums: map[string][sha256.Size]byte{}}
+	for i, path := range paths {
+		if err := c.copy(from, to, path, &m); err != nil {
+			return kindError(KindStorage, fmt.Errorf("can't migrate %s: %w", path, err))
+		}
+		if (i+1)%100 == 0 {
+			logger.Printf("[INFO] Migrated %d of %d records", i+1, len(paths))
+		}
+	}
+
+	if err := c.verify(to, &m); err != nil {
+		return kindError(KindStorage, err)
+	}
+
+	out := c.out
+	if out == nil {
+		out = os.Stdout
+	}
+	_, _ = fmt.Fprintf(out, "Migrated %d records: %d copied, %d already present, %d overwritten, %d conflicts\n",
+		m.Records, m.Copied, m.Skipped, m.Overwritten, len(m.Conflicts))
+	for _, path := range m.Conflicts {
+		_, _ = fmt.Fprintf(out, "conflict: %s\n", path)
+	}
+	if len(m.Conflicts) > 0 {
+		return kindError(KindStorage, fmt.Errorf("%d target records differ from source ones, use --overwrite to replace them", len(m.Conflicts)))
+	}
+	return nil
+}
+
+// copy writes the record to the target unless it is already there with the same content
+func (c *MigrateCommand) copy(from engine.Engine, to engine.Engine, path string, m *migration) error {
+	b, err := from.Read(path)
+	if err != nil {
+		return err
+	}
+	m.checksums[path] = sha256.Sum256(b)
+
+	exists, err := to.Exists(path)
+	if err != nil {
+		return err
+	}
+	if exists {
+		existing, err := to.Read(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(existing, b) {
+			m.Skipped++
+			return nil
+		}
+		if !c.Overwrite {
+			m.Conflicts = append(m.Conflicts, path)
+			delete(m.checksums, path)
+			return nil
+		}
+		m.Overwritten++
+	} else {
+		m.Copied++
+	}
+	return to.Write(path, b)
+}
+
+// verify compares number of records of both engines and checksums of target records with source ones, conflicting
+// records are not verified
+func (c *MigrateCommand) verify(to engine.Engine, m *migration) error {
+	targetPaths, err := to.List("")
+	if err != nil {
+		return fmt.Errorf("can't list target records: %w", err)
+	}
+	if len(targetPaths) < m.Records {
+		return fmt.Errorf("verification failed: target has %d records, source has %d", len(targetPaths), m.Records)
+	}
+
+	for path, sum := range m.checksums {
+		b, err := to.Read(path)
+		if err != nil {
+			return fmt.Errorf("verification failed: can't read %s: %w", path, err)
+		}
+		if sha256.Sum256(b) != sum {
+			return fmt.Errorf("verification failed: checksum of %s differs", path)
+		}
+	}
+	logging.With(logging.Fields{"stage": "migrate"}).Printf("[INFO] Verified %d records", len(m.checksums))
+	return nil
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/umputun/go-flags"
+	"testing"
+)
+
+func TestMigrateCommand_Execute(t *testing.T) {
+	from := memory.NewEngineWith(map[string][]byte{
+		"1.json":            []byte(`{"id":1}`),
+		"2.json":            []byte(`{"id":2}`),
+		"properties-1.json": []byte(`[]`),
+		"krakow-1.json":     []byte(`{"id":1}`),
+	})
+	// interrupted migration has copied some records already
+	to := memory.NewEngineWith(map[string][]byte{
+		"1.json": []byte(`{"id":1}`),
+	})
+
+	cmd, out := newMigrateCommand(t, from, to)
+	err := cmd.Execute(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Migrated 4 records: 3 copied, 1 already present, 0 overwritten, 0 conflicts\n", out.String())
+	assert.Equal(t, from.Records(), to.Records())
+
+	out.Reset()
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Migrated 4 records: 0 copied, 4 already present, 0 overwritten, 0 conflicts\n", out.String())
+}
+
+func TestMigrateCommand_Execute_Conflicts(t *testing.T) {
+	from := memory.NewEngineWith(map[string][]byte{
+		"1.json": []byte(`{"id":1,"price_min":1}`),
+		"2.json": []byte(`{"id":2}`),
+	})
+	to := memory.NewEngineWith(map[string][]byte{
+		"1.json": []byte(`{"id":1,"price_min":2}`),
+	})
+
+	cmd, out := newMigrateCommand(t, from, to)
+	err := cmd.Execute(nil)
+	assert.Equal(t, ExitStorage, ExitCode(err))
+	assert.Equal(t, "Migrated 2 records: 1 copied, 0 already present, 0 overwritten, 1 conflicts\nconflict: 1.json\n", out.String())
+	assert.Equal(t, []byte(`{"id":1,"price_min":2}`), to.Records()["1.json"])
+
+	out.Reset()
+	cmd.Overwrite = true
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Migrated 2 records: 0 copied, 1 already present, 1 overwritten, 0 conflicts\n", out.String())
+	assert.Equal(t, from.Records(), to.Records())
+}
+
+func TestMigrateCommand_Execute_VerificationFailed(t *testing.T) {
+	from := memory.NewEngineWith(map[string][]byte{"1.json": []byte(`{"id":1}`)})
+	to := &corruptingEngine{memory.NewEngine()}
+
+	cmd, _ := newMigrateCommand(t, from, to)
+	err := cmd.Execute(nil)
+	require.Error(t, err)
+	assert.Equal(t, ExitStorage, ExitCode(err))
+	assert.Contains(t, err.Error(), "checksum of 1.json differs")
+}
+
+func TestMigrateCommand_Execute_InvalidEngines(t *testing.T) {
+	cmd := MigrateCommand{From: "a", To: "a", out: &bytes.Buffer{}}
+	cmd.SetEngineOpener(func(url string) (engine.Engine, error) {
+		return memory.NewEngine(), nil
+	})
+	assert.Equal(t, ExitConfig, ExitCode(cmd.Execute(nil)))
+
+	cmd.To = "b"
+	cmd.SetEngineOpener(func(url string) (engine.Engine, error) {
+		return nil, errors.New("unsupported")
+	})
+	assert.Equal(t, ExitConfig, ExitCode(cmd.Execute(nil)))
+}
+
+func newMigrateCommand(t *testing.T, from engine.Engine, to engine.Engine) (*MigrateCommand, *bytes.Buffer) {
+	cmd := &MigrateCommand{}
+	cmd.SetEngineOpener(func(url string) (engine.Engine, error) {
+		if url == "file:///state" {
+			return from, nil
+		}
+		return to, nil
+	})
+	var out bytes.Buffer
+	cmd.out = &out
+	_, err := flags.NewParser(cmd, flags.Default).ParseArgs([]string{"--from=file:///state", "--to=s3://bucket?region=eu-west-1"})
+	require.NoError(t, err)
+	return cmd, &out
+}
+
+// corruptingEngine stores records with a changed content
+type corruptingEngine struct {
+	*memory.Engine
+}
+
+func (e *corruptingEngine) Write(path string, b []byte) error {
+	return e.Engine.Write(path, append(b, '\n'))
+}
@@ -1,28 +1,272 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/api"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/filter"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/metrics"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
-	file "github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/file"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/writer"
-	log "github.com/go-pkgz/lgr"
 	"go.uber.org/multierr"
-	"io/ioutil"
+	"io"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 type OffersUpdatesCommand struct {
 	PropertiesRequest struct {
-		Regions []int64 `short:"r" long:"regions" env:"REGIONS" description:"offer regions"`
+		Regions []string `short:"r" long:"regions" env:"REGIONS" env-delim:"," description:"offer regions by id or name"`
 	} `group:"request" namespace:"request" env-namespace:"REQUEST"`
+	Filter            filter.Options `group:"filter" namespace:"filter" env-namespace:"FILTER"`
+	Profile           []string       `long:"profile" env:"PROFILE" env-delim:"," description:"run only the profiles of config file, all profiles run when not set"`
+	TrackImageChanges bool           `long:"track-image-changes" env:"TRACK_IMAGE_CHANGES" description:"notify when main image of known offer changes"`
+	Watch             time.Duration  `long:"watch" env:"WATCH" description:"run repeatedly with the interval until interrupted, runs once when not set"`
+	Summary           struct {
+		File   string `long:"file" env:"FILE" description:"write run summary as json to the file"`
+		Notify bool   `long:"notify" env:"NOTIFY" description:"send run summary as a message"`
+	} `group:"summary" namespace:"summary" env-namespace:"SUMMARY"`
+	Details struct {
+		Fetch  bool `long:"fetch" env:"FETCH" description:"fetch and store full investment data of new offers"`
+		Notify bool `long:"notify" env:"NOTIFY" description:"include investment data in new offer notifications, implies fetch"`
+	} `group:"details" namespace:"details" env-namespace:"DETAILS"`
+	Properties struct {
+		Track bool `long:"track" env:"TRACK" description:"notify about price and status changes of properties of known offers"`
+	} `group:"properties" namespace:"properties" env-namespace:"PROPERTIES"`
+	Seed                bool   `long:"seed" env:"SEED" description:"persist fetched offers missing in the store without notifications, e.g. on the first run or after adding a region"`
+	QuarantineCorrupted bool   `long:"quarantine-corrupted" env:"QUARANTINE_CORRUPTED" description:"copy corrupted stored offers aside and replace them with fetched ones without notifications"`
+	DryRun              bool   `long:"dry-run" env:"DRY_RUN" description:"run once printing messages and offers instead of sending and saving them"`
+	DryRunFormat        string `long:"dry-run-format" env:"DRY_RUN_FORMAT" choice:"text" choice:"json" default:"text" description:"dry run report format"`
+	FailOn              string `long:"fail-on" env:"FAIL_ON" choice:"any" choice:"api" choice:"storage" choice:"none" default:"any" description:"failures the command fails on"`
+	ErrorThreshold      struct {
+		Ratio     float64 `long:"ratio" env:"RATIO" description:"abort the run when the ratio of failed offers exceeds it, e.g. 0.2, disabled when not set"`
+		MinOffers int     `long:"min-offers" env:"MIN_OFFERS" default:"10" description:"processed offers required before the ratio is checked"`
+	} `group:"error-threshold" namespace:"error-threshold" env-namespace:"ERROR_THRESHOLD"`
+	BelowMedian struct {
+		Ratio     float64 `long:"ratio" env:"RATIO" description:"flag offers priced per m² at least the ratio below their region median, e.g. 0.15, disabled when not set"`
+		MinOffers int     `long:"min-offers" env:"MIN_OFFERS" default:"5" description:"stored offers of a region required to calculate its median"`
+	} `group:"below-median" namespace:"below-median" env-namespace:"BELOW_MEDIAN"`
 	CommonOpts
+
+	summary   *RunSummary
+	threshold *failureThreshold
+	// regions are ids of the requested regions resolved on start, or regions of the running profile
+	regions []int64
+	// medians are region medians of price per m² of stored offers, set when flagging offers below median
+	medians map[string]float64
+	// profile is a name of the currently running profile
+	profile string
+	// out receives dry run report, stdout when not set
+	out io.Writer
 }
 
 func (cmd *OffersUpdatesCommand) Execute(_ []string) error {
-	resetEnv("TELEGRAM_CHAT_ID", "TELEGRAM_TOKEN", "AWS_ACCESS_KEY", "AWS_SECRET_KET")
+	resetEnv("TELEGRAM_CHAT_ID", "TELEGRAM_TOKEN", "AWS_ACCESS_KEY", "AWS_SECRET_KET", "ENCRYPTION_KEY", "ENCRYPTION_OLD_KEYS")
+
+	if err := cmd.checkProfiles(); err != nil {
+		return err
+	}
+	if cmd.Seed && cmd.Watch > 0 {
+		return ConfigError(errors.New("seed can't be combined with watch, seed once before watching"))
+	}
+	regions, err := api.ResolveRegions(cmd.PrimaryMarketAPI, cmd.PropertiesRequest.Regions)
+	if err != nil {
+		return ConfigError(fmt.Errorf("request regions: %w", err))
+	}
+	cmd.regions = regions
+	if cmd.DryRun {
+		return applyFailOn(cmd.FailOn, cmd.runProfiles(cmd.dryRun))
+	}
+	if cmd.Watch <= 0 {
+		return applyFailOn(cmd.FailOn, cmd.runProfiles(cmd.run))
+	}
+	return cmd.watch()
+}
+
+// watch runs offers updates every watch interval until the process is interrupted
+func (cmd *OffersUpdatesCommand) watch() error {
+	logging.With(logging.Fields{"stage": "watch"}).Printf("[INFO] Watching offers updates every %v..", cmd.Watch)
+
+	stopCh := make(chan os.Signal, 1)
+	signal.Notify(stopCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stopCh)
+
+	ticker := time.NewTicker(cmd.Watch)
+	defer ticker.Stop()
+
+	for {
+		if err := applyFailOn(cmd.FailOn, cmd.runProfiles(cmd.run)); err != nil {
+			logging.With(logging.Fields{"stage": "watch", "error": err}).Printf("[WARN] Offers updates run failed")
+		}
+
+		select {
+		case <-ticker.C:
+		case sig := <-stopCh:
+			logging.With(logging.Fields{"stage": "watch"}).Printf("[INFO] %v received, stopping..", sig)
+			return nil
+		}
+	}
+}
+
+// checkProfiles makes sure profiles selected with --profile are configured and regions are not requested along
+// with profiles, which run their own regions
+func (cmd *OffersUpdatesCommand) checkProfiles() error {
+	if len(cmd.Profiles) > 0 && len(cmd.PropertiesRequest.Regions) > 0 {
+		return ConfigError(errors.New("request regions can't be combined with config file profiles, set regions of profiles instead"))
+	}
+	for _, name := range cmd.Profile {
+		found := false
+		for _, p := range cmd.Profiles {
+			found = found || p.Name == name
+		}
+		if !found {
+			return ConfigError(fmt.Errorf("profile %s is not configured", name))
+		}
+	}
+	return nil
+}
+
+// runProfiles calls run for every selected profile with its regions, filter, writer and store, or once with
+// the command options when there are no profiles
+func (cmd *OffersUpdatesCommand) runProfiles(run func() error) error {
+	if len(cmd.Profiles) == 0 {
+		return run()
+	}
+
+	regions, flt, common := cmd.regions, cmd.Filter, cmd.CommonOpts
+	defer func() {
+		cmd.regions, cmd.Filter, cmd.CommonOpts = regions, flt, common
+		cmd.profile = ""
+	}()
+
+	var err error
+	for _, p := range cmd.Profiles {
+		if !cmd.profileSelected(p.Name) {
+			continue
+		}
+		logging.With(logging.Fields{"stage": "run", "profile": p.Name}).Printf("[INFO] Running profile %v..", p.Name)
+		cmd.profile = p.Name
+		cmd.regions = p.Regions
+		cmd.Filter = p.Filter
+		cmd.OfferWriter = p.OfferWriter
+		cmd.OfferStore = p.OfferStore
+		cmd.PropertyStore = p.PropertyStore
+		if pErr := run(); pErr != nil {
+			err = multierr.Append(err, pErr)
+		}
+	}
+	return err
+}
+
+func (cmd *OffersUpdatesCommand) profileSelected(name string) bool {
+	if len(cmd.Profile) == 0 {
+		return true
+	}
+	for _, p := range cmd.Profile {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// dryRun runs offers updates once against the real store recording messages and saved offers instead of
+// sending and persisting them, then prints the report
+func (cmd *OffersUpdatesCommand) dryRun() error {
+	report := &dryRunReport{Profile: cmd.profile}
+	offerWriter, offerStore, propertyStore := cmd.OfferWriter, cmd.OfferStore, cmd.PropertyStore
+	cmd.OfferWriter = &dryRunWriter{report: report}
+	cmd.OfferStore = &dryRunStore{OfferStore: offerStore, report: report}
+	cmd.PropertyStore = &dryRunPropertyStore{PropertyStore: propertyStore}
+	defer func() {
+		cmd.OfferWriter, cmd.OfferStore, cmd.PropertyStore = offerWriter, offerStore, propertyStore
+	}()
 
-	log.Printf("[DEBUG] Executing offers updates command..")
+	err := cmd.run()
+
+	out := cmd.out
+	if out == nil {
+		out = os.Stdout
+	}
+	return multierr.Append(err, report.print(out, cmd.DryRunFormat))
+}
+
+// run executes offers updates once under a new correlation id and records run metrics and health
+func (cmd *OffersUpdatesCommand) run() error {
+	runId := logging.StartRun()
+	started := cmd.Clock.Now()
+	cmd.summary = newRunSummary(runId, started)
+	cmd.summary.Profile = cmd.profile
+	cmd.threshold = newFailureThreshold(cmd.ErrorThreshold.Ratio, cmd.ErrorThreshold.MinOffers)
+	cmd.loadRegionMedians()
+
+	err := cmd.execute()
+	cmd.pruneImages()
+	if sErr := cmd.snapshot(); sErr != nil {
+		err = multierr.Append(err, kindError(KindStorage, sErr))
+	}
+
+	finished := cmd.Clock.Now()
+	cmd.summary.finish(finished)
+	metrics.ObserveRun(started, finished, err)
+	// in watch mode the fail-on policy decides which runs count as failed for health checks
+	cmd.Health.RunFinished(applyFailOn(cmd.FailOn, err))
+	logging.With(logging.Fields{"stage": "run", "duration": finished.Sub(started), "error": err}).Printf("[INFO] Offers updates run finished")
+	cmd.reportSummary()
+	return err
+}
+
+// snapshot saves records of the memory engine, so a crash of a long running watch loses a single run at most.
+// Dry run leaves the snapshot as it was.
+func (cmd *OffersUpdatesCommand) snapshot() error {
+	if cmd.Snapshot == nil || cmd.DryRun {
+		return nil
+	}
+	if err := cmd.Snapshot(); err != nil {
+		logging.With(logging.Fields{"stage": "run", "error": err}).Printf("[WARN] Can't save memory engine snapshot")
+		return err
+	}
+	return nil
+}
+
+// pruneImages removes expired cached images, failures only leave them for the next run. Dry run doesn't touch
+// the cache.
+func (cmd *OffersUpdatesCommand) pruneImages() {
+	if cmd.PruneImages == nil || cmd.DryRun {
+		return
+	}
+	if err := cmd.PruneImages(); err != nil {
+		logging.With(logging.Fields{"stage": "run", "error": err}).Printf("[WARN] Can't prune cached images")
+	}
+}
+
+// reportSummary logs the run summary, writes it to the summary file and sends it as a message when configured
+func (cmd *OffersUpdatesCommand) reportSummary() {
+	logger := logging.With(logging.Fields{"stage": "summary"})
+	txt := cmd.summary.Text()
+	logger.Printf("[INFO] %s", txt)
+
+	if cmd.Summary.File != "" {
+		if err := cmd.summary.WriteFile(cmd.Summary.File); err != nil {
+			logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't write run summary to %v", cmd.Summary.File)
+		}
+	}
+	if cmd.Summary.Notify {
+		if _, err := cmd.OfferWriter.Write(writer.Message{Text: txt}); err != nil {
+			logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't send run summary")
+		}
+	}
+}
+
+func (cmd *OffersUpdatesCommand) execute() error {
+	logging.With(logging.Fields{"stage": "run"}).Printf("[DEBUG] Executing offers updates command..")
 
 	doneCh := make(chan bool)
 	errCh := make(chan error)
@@ -47,15 +291,19 @@ func (cmd *OffersUpdatesCommand) Execute(_ []string) error {
 func (cmd *OffersUpdatesCommand) doExecute(doneCh chan<- bool, errCh chan<- error) {
 	go func() {
 
-		newOffersCh, priseRiseCh, priseDropCh := cmd.orchestrateOffers(errCh,
-			cmd.mapApiOffers(errCh,
-				cmd.fetchOffers(errCh,
-					cmd.streamRegions())))
+		routes := cmd.orchestrateOffers(errCh,
+			cmd.filterOffers(errCh,
+				cmd.mapApiOffers(errCh,
+					cmd.fetchOffers(errCh,
+						cmd.streamRegions()))))
 
 		persistOffersCh := merge(
-			cmd.writeNewOffers(errCh, newOffersCh),
-			cmd.writeOffersPriceRise(errCh, priseRiseCh),
-			cmd.writeOffersPriceDrop(errCh, priseDropCh),
+			cmd.writeNewOffers(errCh, routes.newOffers),
+			cmd.writeOffersPriceRise(errCh, routes.priceRise),
+			cmd.writeOffersPriceDrop(errCh, routes.priceDrop),
+			cmd.writeOffersImageChange(errCh, routes.imageChange),
+			cmd.writePropertyChanges(errCh, routes.properties),
+			routes.unnotified,
 		)
 
 		cmd.persistOffers(doneCh, errCh, persistOffersCh)
@@ -68,7 +316,7 @@ func (cmd *OffersUpdatesCommand) streamRegions() <-chan int64 {
 	go func() {
 		defer close(regionsCh)
 
-		for _, r := range cmd.PropertiesRequest.Regions {
+		for _, r := range cmd.regions {
 			regionsCh <- r
 		}
 	}()
@@ -77,12 +325,13 @@ func (cmd *OffersUpdatesCommand) streamRegions() <-chan int64 {
 
 // fetchOffers performs api call to get all available offers for specified region. Uses pagination to satisfy page size condition.
 func (cmd *OffersUpdatesCommand) fetchOffers(errCh chan<- error, regionCh <-chan int64) <-chan api.Offer {
-	log.Printf("[DEBUG] Fetching orders..")
+	logging.With(logging.Fields{"stage": "fetch"}).Printf("[DEBUG] Fetching orders..")
 
 	offersCh := make(chan api.Offer)
 
 	go func() {
 		defer close(offersCh)
+		defer cmd.summary.stageFinished("fetch", time.Now())
 
 		var offersWg sync.WaitGroup
 
@@ -94,7 +343,14 @@ func (cmd *OffersUpdatesCommand) fetchOffers(errCh chan<- error, regionCh <-chan
 			go func() {
 				defer offersWg.Done()
 
-				cmd.fetchRegionOffers(errCh, region, offersCh)
+				if err := cmd.fetchRegionOffers(region, offersCh); err != nil {
+					errCh <- err
+					return
+				}
+				// regions cut short by an aborted run are not processed
+				if !cmd.threshold.exceeded() {
+					cmd.summary.inc(&cmd.summary.RegionsProcessed)
+				}
 			}()
 		}
 
@@ -103,9 +359,15 @@ func (cmd *OffersUpdatesCommand) fetchOffers(errCh chan<- error, regionCh <-chan
 	return offersCh
 }
 
-// fetchRegionOffers fetches offers for provided region id
-func (cmd *OffersUpdatesCommand) fetchRegionOffers(errCh chan<- error, region int64, offersCh chan<- api.Offer) {
-	log.Printf("[DEBUG] Fetching orders for region %v..", region)
+// fetchRegionOffers fetches offers for provided region id, stops fetching when the run is aborted
+func (cmd *OffersUpdatesCommand) fetchRegionOffers(region int64, offersCh chan<- api.Offer) error {
+	logger := logging.With(logging.Fields{"stage": "fetch", "region": region})
+	logger.Printf("[DEBUG] Fetching orders for region %v..", region)
+
+	started := time.Now()
+	defer func() {
+		logger.With(logging.Fields{"duration": time.Since(started)}).Printf("[DEBUG] Fetched orders for region %v", region)
+	}()
 
 	offersPage, err := cmd.PrimaryMarketAPI.GetOffers(
 		api.PageableOffersRequest{
@@ -117,35 +379,44 @@ func (cmd *OffersUpdatesCommand) fetchRegionOffers(errCh chan<- error, region in
 	for ok := true; ok; ok = err != nil || len(offersPage.Results) > 0 {
 
 		if err != nil {
-			errCh <- err
-			return
+			logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't fetch orders for region %v", region)
+			return kindError(KindApi, err)
 		}
 
-		log.Printf("[DEBUG] Fetched %v chunk of offers with size %v", offersPage.Page, offersPage.PageSize)
+		logger.Printf("[DEBUG] Fetched %v chunk of offers with size %v", offersPage.Page, offersPage.PageSize)
 
 		for _, offer := range offersPage.Results {
+			if cmd.threshold.exceeded() {
+				logger.Printf("[DEBUG] Run aborted, stopping fetching region %v", region)
+				return nil
+			}
+			logger.With(logging.Fields{"offer_id": offer.Id}).Printf("[DEBUG] Fetched offer id %v", offer.Id)
+			metrics.OffersFetched.WithLabelValues(strconv.FormatInt(region, 10)).Inc()
+			cmd.summary.inc(&cmd.summary.OffersFetched)
 			offersCh <- offer
 		}
 
 		if offersPage.Next == "" {
-			return
+			return nil
 		}
 
 		offersPage, err = cmd.PrimaryMarketAPI.GetOffersNextPage(*offersPage)
 	}
+	return nil
 }
 
 // mapApiOffers maps to domain struct
 func (cmd *OffersUpdatesCommand) mapApiOffers(_ chan<- error, apiOfferCh <-chan api.Offer) chan store.Offer {
-	log.Printf("[DEBUG] Mapping orders..")
+	logging.With(logging.Fields{"stage": "map"}).Printf("[DEBUG] Mapping orders..")
 
 	storeOfferCh := make(chan store.Offer)
 	go func() {
 		defer close(storeOfferCh)
+		defer cmd.summary.stageFinished("map", time.Now())
 
 		for apiOffer := range apiOfferCh {
 
-			log.Printf("[DEBUG] Creating store offer for id %v..", apiOffer.Id)
+			logging.With(logging.Fields{"stage": "map", "offer_id": apiOffer.Id}).Printf("[DEBUG] Creating store offer for id %v..", apiOffer.Id)
 			storeOffer := store.Offer{
 				Id:            apiOffer.Id,
 				Slug:          apiOffer.Slug,
@@ -160,6 +431,10 @@ func (cmd *OffersUpdatesCommand) mapApiOffers(_ chan<- error, apiOfferCh <-chan
 				AreaMin:       apiOffer.Stats.RangesAreaMin,
 				AreaMax:       apiOffer.Stats.RangesAreaMax,
 			}
+			if len(apiOffer.GeoPoint.Coordinates) == 2 {
+				storeOffer.Longitude = apiOffer.GeoPoint.Coordinates[0]
+				storeOffer.Latitude = apiOffer.GeoPoint.Coordinates[1]
+			}
 
 			storeOfferCh <- storeOffer
 		}
@@ -167,101 +442,299 @@ func (cmd *OffersUpdatesCommand) mapApiOffers(_ chan<- error, apiOfferCh <-chan
 	return storeOfferCh
 }
 
+// filterOffers skips offers the filter does not accept and tags offers with the neighbourhood they are inside.
+// Offers listed without coordinates are located with coordinates of the stored offer when filtered by location.
+func (cmd *OffersUpdatesCommand) filterOffers(_ chan<- error, offerCh <-chan store.Offer) <-chan store.Offer {
+	logging.With(logging.Fields{"stage": "filter"}).Printf("[DEBUG] Filtering orders..")
+
+	filteredOfferCh := make(chan store.Offer)
+	go func() {
+		defer close(filteredOfferCh)
+		defer cmd.summary.stageFinished("filter", time.Now())
+
+		for offer := range offerCh {
+			if cmd.Filter.NeedsCoordinates() && !filter.HasCoordinates(offer) {
+				offer = cmd.withStoredCoordinates(offer)
+				if !filter.HasCoordinates(offer) {
+					logging.With(logging.Fields{"stage": "filter", "offer_id": offer.Id}).Printf("[DEBUG] Skipping offer id %v without coordinates..", offer.Id)
+					cmd.summary.inc(&cmd.summary.SkippedNoCoordinates)
+					continue
+				}
+			}
+			if !cmd.Filter.Accepts(offer) {
+				logging.With(logging.Fields{"stage": "filter", "offer_id": offer.Id}).Printf("[DEBUG] Skipping offer id %v by filter..", offer.Id)
+				cmd.summary.inc(&cmd.summary.SkippedByFilter)
+				continue
+			}
+			offer.Neighbourhood = cmd.Filter.Neighbourhoods.Match(offer)
+			filteredOfferCh <- offer
+		}
+	}()
+	return filteredOfferCh
+}
+
+// withStoredCoordinates sets coordinates of the stored offer or its details, the offer is returned as it is when
+// it is not stored or has no coordinates either
+func (cmd *OffersUpdatesCommand) withStoredCoordinates(offer store.Offer) store.Offer {
+	stored, err := cmd.OfferStore.Get(offer.Id)
+	if err != nil {
+		return offer
+	}
+	if lat, lon, ok := stored.Coordinates(); ok {
+		offer.Latitude, offer.Longitude = lat, lon
+	}
+	return offer
+}
+
+// offerRoutes groups channels orchestrateOffers redirects offers to
+type offerRoutes struct {
+	newOffers   <-chan store.Offer
+	priceRise   <-chan store.Offer
+	priceDrop   <-chan store.Offer
+	imageChange <-chan store.Offer
+	// unnotified receives offers which have to be persisted without any notification
+	unnotified <-chan store.Offer
+	// properties receives all offers when properties are tracked, offers are not persisted from this route
+	properties <-chan store.Offer
+}
+
 // orchestrateOffers filters already processed offers using offer store, compares prices and redirects
-func (cmd *OffersUpdatesCommand) orchestrateOffers(errCh chan<- error, apiOfferCh <-chan store.Offer) (<-chan store.Offer, <-chan store.Offer, <-chan store.Offer) {
-	log.Printf("[DEBUG] Filtering orders..")
+func (cmd *OffersUpdatesCommand) orchestrateOffers(errCh chan<- error, apiOfferCh <-chan store.Offer) offerRoutes {
+	logging.With(logging.Fields{"stage": "orchestrate"}).Printf("[DEBUG] Filtering orders..")
 
 	newOffersCh := make(chan store.Offer)
 	priceRiseCh := make(chan store.Offer)
 	priceDropCh := make(chan store.Offer)
+	imageChangeCh := make(chan store.Offer)
+	unnotifiedCh := make(chan store.Offer)
+	propertiesCh := make(chan store.Offer)
 	go func() {
 		defer func() {
 			close(newOffersCh)
 			close(priceRiseCh)
 			close(priceDropCh)
+			close(imageChangeCh)
+			close(unnotifiedCh)
+			close(propertiesCh)
 		}()
+		defer cmd.summary.stageFinished("orchestrate", time.Now())
 
 		for offer := range apiOfferCh {
+			if cmd.threshold.exceeded() {
+				continue
+			}
+			cmd.threshold.offerProcessed()
+
+			logger := logging.With(logging.Fields{"stage": "orchestrate", "offer_id": offer.Id})
 
 			existing, err := cmd.OfferStore.Get(offer.Id)
 			if err != nil {
-				if _, ok := err.(file.NoPathError); ok {
-					log.Printf("[DEBUG] Message id %v does not exist..", offer.Id)
+				if errors.Is(err, engine.ErrNotFound) {
+					offer.RecordPrice(offer.ImportedAt)
+					if cmd.Properties.Track {
+						propertiesCh <- offer
+					}
+					if cmd.Seed {
+						cmd.seedOffer(offer, unnotifiedCh)
+						continue
+					}
+					logger.Printf("[DEBUG] Message id %v does not exist..", offer.Id)
+					metrics.OffersRouted.WithLabelValues(metrics.RouteNew).Inc()
+					cmd.summary.inc(&cmd.summary.New)
 					newOffersCh <- offer
 					continue
 				}
-				errCh <- err
+				var corrupted *store.CorruptedRecordError
+				if errors.As(err, &corrupted) {
+					cmd.orchestrateCorrupted(offer, corrupted, errCh, unnotifiedCh)
+					continue
+				}
+				logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't get stored offer id %v", offer.Id)
+				cmd.offerFailed(errCh, kindError(KindStorage, err))
 				continue
 			}
 
+			offer.NotificationRef = existing.NotificationRef
+			offer.MainImageHash = existing.MainImageHash
+			offer.Details = existing.Details
+			offer.PriceHistory = existing.History()
+			offer.RecordPrice(offer.ImportedAt)
+			if cmd.Properties.Track {
+				propertiesCh <- offer
+			}
 			diff := existing.CompareAveragePrices(offer)
 
 			if diff < 0 {
+				metrics.OffersRouted.WithLabelValues(metrics.RoutePriceRise).Inc()
+				cmd.summary.inc(&cmd.summary.Risen)
 				priceRiseCh <- offer
 			}
 			if diff > 0 {
+				metrics.OffersRouted.WithLabelValues(metrics.RoutePriceDrop).Inc()
+				cmd.summary.inc(&cmd.summary.Dropped)
 				priceDropCh <- offer
 			}
+			if diff == 0 && !(cmd.TrackImageChanges && cmd.orchestrateImageChange(offer, imageChangeCh, unnotifiedCh)) {
+				cmd.summary.inc(&cmd.summary.Unchanged)
+			}
 		}
 	}()
-	return newOffersCh, priceRiseCh, priceDropCh
+	return offerRoutes{
+		newOffers:   newOffersCh,
+		priceRise:   priceRiseCh,
+		priceDrop:   priceDropCh,
+		imageChange: imageChangeCh,
+		unnotified:  unnotifiedCh,
+		properties:  propertiesCh,
+	}
+}
+
+// seedOffer redirects the offer to be persisted without any notification
+func (cmd *OffersUpdatesCommand) seedOffer(offer store.Offer, unnotifiedCh chan<- store.Offer) {
+	logging.With(logging.Fields{"stage": "orchestrate", "offer_id": offer.Id}).Printf("[DEBUG] Seeding offer id %v..", offer.Id)
+	metrics.OffersRouted.WithLabelValues(metrics.RouteSeed).Inc()
+	cmd.summary.inc(&cmd.summary.Seeded)
+	unnotifiedCh <- offer
+}
+
+// orchestrateCorrupted quarantines the corrupted stored offer and persists the fetched one without any notification,
+// as its previous state is unknown. Fails the offer when quarantine is disabled.
+func (cmd *OffersUpdatesCommand) orchestrateCorrupted(offer store.Offer, corrupted *store.CorruptedRecordError, errCh chan<- error, unnotifiedCh chan<- store.Offer) {
+	logger := logging.With(logging.Fields{"stage": "orchestrate", "offer_id": offer.Id, "path": corrupted.Path, "error": corrupted.Err})
+	if !cmd.QuarantineCorrupted {
+		logger.Printf("[ERROR] Stored offer id %v is corrupted, use --quarantine-corrupted to replace it", offer.Id)
+		cmd.offerFailed(errCh, kindError(KindStorage, corrupted))
+		return
+	}
+	if err := cmd.OfferStore.Quarantine(offer.Id); err != nil {
+		logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't quarantine corrupted offer id %v", offer.Id)
+		cmd.offerFailed(errCh, kindError(KindStorage, err))
+		return
+	}
+	logger.Printf("[WARN] Stored offer id %v is corrupted, quarantined it", offer.Id)
+	offer.RecordPrice(offer.ImportedAt)
+	metrics.OffersRouted.WithLabelValues(metrics.RouteQuarantine).Inc()
+	cmd.summary.inc(&cmd.summary.Quarantined)
+	unnotifiedCh <- offer
+}
+
+// orchestrateImageChange compares stored main image hash with the current one, offers without stored hash get it
+// persisted silently so the next change can be detected. Reports whether the image has changed.
+func (cmd *OffersUpdatesCommand) orchestrateImageChange(offer store.Offer, imageChangeCh chan<- store.Offer, unnotifiedCh chan<- store.Offer) bool {
+	// fetched images are cached in the engine, which dry run must not touch
+	if len(offer.MainImageLink) == 0 || cmd.DryRun {
+		return false
+	}
+
+	img, err := cmd.ImageFetcher.Fetch(offer.MainImageLink)
+	if err != nil {
+		logging.With(logging.Fields{"stage": "orchestrate", "offer_id": offer.Id, "error": err}).
+			Printf("[WARN] Can't get main image for offer id %v, skipping image change check", offer.Id)
+		return false
+	}
+	if img.Hash == offer.MainImageHash {
+		return false
+	}
+
+	previousHash := offer.MainImageHash
+	offer.MainImageHash = img.Hash
+	if previousHash == "" {
+		unnotifiedCh <- offer
+		return false
+	}
+	logging.With(logging.Fields{"stage": "orchestrate", "offer_id": offer.Id}).Printf("[DEBUG] Main image of offer id %v changed..", offer.Id)
+	metrics.OffersRouted.WithLabelValues(metrics.RouteImageChange).Inc()
+	cmd.summary.inc(&cmd.summary.ImageChanged)
+	imageChangeCh <- offer
+	return true
 }
 
 // writeNewOffers writes an information about newly processed offers
 func (cmd *OffersUpdatesCommand) writeNewOffers(errCh chan<- error, offerCh <-chan store.Offer) <-chan store.Offer {
-	log.Printf("[DEBUG] Notifying orders updates..")
+	logging.With(logging.Fields{"stage": "notify"}).Printf("[DEBUG] Notifying orders updates..")
 
 	notifiedOfferCh := make(chan store.Offer)
 	go func() {
 		defer close(notifiedOfferCh)
+		defer cmd.summary.stageFinished("notify", time.Now())
 
 		for offer := range offerCh {
+			if cmd.threshold.exceeded() {
+				continue
+			}
 
-			b := make([]byte, 0)
-			if len(offer.MainImageLink) > 0 {
-
-				log.Printf("[DEBUG] Getting main image for offer id %v..", offer.Id)
-
-				imgResp, err := cmd.HttpClient.Get(offer.MainImageLink)
-				if err != nil {
-					errCh <- err
-					continue
-				}
+			logger := logging.With(logging.Fields{"stage": "notify", "offer_id": offer.Id})
+			logger.Printf("[DEBUG] Creating a notification for offer id %v..", offer.Id)
 
-				b, err = ioutil.ReadAll(imgResp.Body)
-				if err != nil {
-					errCh <- err
-					continue
-				}
+			if cmd.Details.Fetch || cmd.Details.Notify {
+				offer.Details = cmd.fetchDetails(offer)
 			}
 
-			log.Printf("[DEBUG] Creating a notification for offer id %v..", offer.Id)
-
 			txt := "" +
 				"🏡" + offer.Name + "\n" +
-				"📍 " + offer.RegionName + "\n" +
+				"📍 " + offer.RegionName + "\n"
+			if offer.Neighbourhood != "" {
+				txt = txt + "🗺 " + offer.Neighbourhood + "\n"
+			}
+			txt = txt +
 				"📏 " + strconv.Itoa(offer.AreaMin) + "-" + strconv.Itoa(offer.AreaMax) + "\n"
 			if offer.PriceMin > 0 || offer.PriceMax > 0 {
 				txt = txt + "🙀 " + strconv.FormatInt(offer.PriceMin, 10) + "-" + strconv.FormatInt(offer.PriceMax, 10) + "\n"
 			}
+			txt = txt + cmd.belowMedianText(offer)
+			if cmd.Details.Notify && offer.Details != nil {
+				txt = txt + detailsText(offer.Details)
+			}
+			for _, d := range filter.Distances(offer, cmd.Filter.Near) {
+				txt = txt + "📐 " + d.Name + ": " + strconv.FormatFloat(d.Km, 'f', 1, 64) + " km\n"
+			}
 			txt = txt + "\n" +
 				"➡️ " + offer.Link
 
-			err := cmd.OfferWriter.Write(writer.Message{
+			msg := writer.Message{
 				Title: offer.MainImageLink,
-				Image: b,
 				Text:  txt,
-			})
+			}
+			offer.MainImageHash = cmd.attachImage(&msg, offer)
+
+			ref, err := cmd.write(errCh, logger, msg)
 			if err != nil {
-				errCh <- err
+				cmd.offerFailed(errCh, kindError(KindNotification, err))
 				continue
 			}
+			offer.NotificationRef = ref
 			notifiedOfferCh <- offer
 		}
 	}()
 	return notifiedOfferCh
 }
 
+// attachImage attaches offer main image to the message and returns its hash, the message stays text-only when
+// the image is not available
+func (cmd *OffersUpdatesCommand) attachImage(msg *writer.Message, offer store.Offer) string {
+	if len(offer.MainImageLink) == 0 {
+		return offer.MainImageHash
+	}
+
+	if w, ok := cmd.OfferWriter.(writer.RemoteImageWriter); ok && w.AcceptsImageUrl() {
+		msg.ImageUrl = offer.MainImageLink
+		return offer.MainImageHash
+	}
+
+	logger := logging.With(logging.Fields{"stage": "notify", "offer_id": offer.Id})
+	logger.Printf("[DEBUG] Getting main image for offer id %v..", offer.Id)
+
+	img, err := cmd.ImageFetcher.Fetch(offer.MainImageLink)
+	if err != nil {
+		logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't get main image for offer id %v, notifying without it", offer.Id)
+		// title names the image, text-only messages must not show it
+		msg.Title = ""
+		return offer.MainImageHash
+	}
+	msg.Image = img.Bytes
+	return img.Hash
+}
+
 func (cmd *OffersUpdatesCommand) writeOffersPriceRise(errCh chan<- error, offerCh <-chan store.Offer) <-chan store.Offer {
 	return cmd.writeOffersPriceChange(errCh, offerCh, "↗️")
 }
@@ -270,49 +743,141 @@ func (cmd *OffersUpdatesCommand) writeOffersPriceDrop(errCh chan<- error, offerC
 	return cmd.writeOffersPriceChange(errCh, offerCh, "↘️")
 }
 
-// writeNewOffers writes an information about newly processed offers
+// writeOffersImageChange writes the new main image of offers as a reply to the first offer notification
+func (cmd *OffersUpdatesCommand) writeOffersImageChange(errCh chan<- error, offerCh <-chan store.Offer) <-chan store.Offer {
+	logging.With(logging.Fields{"stage": "notify"}).Printf("[DEBUG] Notifying orders image updates..")
+
+	notifiedOfferCh := make(chan store.Offer)
+	go func() {
+		defer close(notifiedOfferCh)
+		defer cmd.summary.stageFinished("notify", time.Now())
+
+		for offer := range offerCh {
+			if cmd.threshold.exceeded() {
+				continue
+			}
+
+			logger := logging.With(logging.Fields{"stage": "notify", "offer_id": offer.Id})
+			logger.Printf("[DEBUG] Creating an image change notification for offer id %v..", offer.Id)
+
+			msg := writer.Message{
+				Title:   offer.MainImageLink,
+				Text:    "➡️ " + offer.Link + "\n\n🖼 main image changed",
+				ReplyTo: offer.NotificationRef,
+			}
+			cmd.attachImage(&msg, offer)
+			// the image couldn't be attached, the message links it instead
+			if len(msg.Image) == 0 && msg.ImageUrl == "" {
+				msg.Text = msg.Text + ": " + offer.MainImageLink
+			}
+
+			ref, err := cmd.write(errCh, logger, msg)
+			if err != nil {
+				cmd.offerFailed(errCh, kindError(KindNotification, err))
+				continue
+			}
+			if offer.NotificationRef == "" {
+				offer.NotificationRef = ref
+			}
+			notifiedOfferCh <- offer
+		}
+	}()
+	return notifiedOfferCh
+}
+
+// writeOffersPriceChange writes an information about offer price change as a reply to the first offer notification
 func (cmd *OffersUpdatesCommand) writeOffersPriceChange(errCh chan<- error, offerCh <-chan store.Offer, change string) <-chan store.Offer {
-	log.Printf("[DEBUG] Notifying orders updates..")
+	logging.With(logging.Fields{"stage": "notify"}).Printf("[DEBUG] Notifying orders updates..")
 
 	notifiedOfferCh := make(chan store.Offer)
 	go func() {
 		defer close(notifiedOfferCh)
+		defer cmd.summary.stageFinished("notify", time.Now())
 
 		for offer := range offerCh {
+			if cmd.threshold.exceeded() {
+				continue
+			}
 
-			log.Printf("[DEBUG] Creating a notification for offer id %v..", offer.Id)
+			logger := logging.With(logging.Fields{"stage": "notify", "offer_id": offer.Id})
+			logger.Printf("[DEBUG] Creating a notification for offer id %v..", offer.Id)
 
-			err := cmd.OfferWriter.Write(writer.Message{
+			ref, err := cmd.write(errCh, logger, writer.Message{
 				Image: make([]byte, 0),
 				Text: "" +
 					"➡️ " + offer.Link + "\n" +
 					"\n" +
-					change + " " + strconv.FormatInt(offer.PriceMin, 10) + "-" + strconv.FormatInt(offer.PriceMax, 10),
+					change + " " + strconv.FormatInt(offer.PriceMin, 10) + "-" + strconv.FormatInt(offer.PriceMax, 10) +
+					strings.TrimSuffix("\n"+cmd.belowMedianText(offer), "\n"),
+				ReplyTo: offer.NotificationRef,
 			})
 			if err != nil {
-				errCh <- err
+				cmd.offerFailed(errCh, kindError(KindNotification, err))
 				continue
 			}
+			if offer.NotificationRef == "" {
+				offer.NotificationRef = ref
+			}
 			notifiedOfferCh <- offer
 		}
 	}()
 	return notifiedOfferCh
 }
 
+// write writes the notification logging its duration and result. A notification written by some of writers only
+// is reported as a notification error, but its reference is returned as the message is not to be written again.
+func (cmd *OffersUpdatesCommand) write(errCh chan<- error, logger logging.Logger, msg writer.Message) (string, error) {
+	started := time.Now()
+	ref, err := cmd.OfferWriter.Write(msg)
+	logger = logger.With(logging.Fields{"duration": time.Since(started)})
+	var partial *writer.PartialError
+	if errors.As(err, &partial) {
+		cmd.summary.inc(&cmd.summary.NotificationFailures)
+		logger.With(logging.Fields{"error": err}).Printf("[WARN] Notification written partially")
+		errCh <- kindError(KindNotification, err)
+		return ref, nil
+	}
+	if err != nil {
+		cmd.summary.inc(&cmd.summary.NotificationFailures)
+		logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't write notification")
+		return "", err
+	}
+	logger.Printf("[DEBUG] Notification written")
+	return ref, nil
+}
+
+// offerFailed reports a failure of a single offer and aborts the run when failed offers exceed the threshold
+func (cmd *OffersUpdatesCommand) offerFailed(errCh chan<- error, err error) {
+	errCh <- err
+	if abortErr := cmd.threshold.offerFailed(); abortErr != nil {
+		logging.With(logging.Fields{"stage": "run", "error": abortErr}).Printf("[ERROR] Aborting offers updates run")
+		errCh <- abortErr
+	}
+}
+
 // persistOffers persists offer processing information
 func (cmd *OffersUpdatesCommand) persistOffers(doneCh chan<- bool, errCh chan<- error, offerCh <-chan store.Offer) {
-	log.Printf("[DEBUG] Persisting orders..")
+	logging.With(logging.Fields{"stage": "persist"}).Printf("[DEBUG] Persisting orders..")
 
 	go func() {
+		stageStarted := time.Now()
 		for offer := range offerCh {
 
-			log.Printf("[DEBUG] Persisting store offer for id %v..", offer.Id)
+			logger := logging.With(logging.Fields{"stage": "persist", "offer_id": offer.Id})
+			logger.Printf("[DEBUG] Persisting store offer for id %v..", offer.Id)
 
+			started := time.Now()
 			err := cmd.OfferStore.Save(offer)
+			logger = logger.With(logging.Fields{"duration": time.Since(started)})
 			if err != nil {
-				errCh <- err
+				cmd.summary.inc(&cmd.summary.PersistFailures)
+				logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't persist store offer for id %v", offer.Id)
+				cmd.offerFailed(errCh, kindError(KindStorage, err))
+				continue
 			}
+			logger.Printf("[DEBUG] Persisted store offer for id %v", offer.Id)
 		}
+		cmd.summary.stageFinished("persist", stageStarted)
 
 		doneCh <- true
 	}()
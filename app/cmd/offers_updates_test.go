@@ -1,19 +1,27 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/api"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/filter"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/health"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/media"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
-	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/file"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/memory"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/writer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/umputun/go-flags"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"testing"
-	"testing/fstest"
 	"time"
 )
 
@@ -40,17 +48,18 @@ func TestOffersUpdatesCommand_Execute(t *testing.T) {
 	})
 	mux.HandleFunc("/1.jpg", func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "GET", r.Method)
+		w.Header().Set("Content-Type", "image/jpeg")
 		_, _ = fmt.Fprint(w, "yay")
 	})
 	mux.HandleFunc("/2.jpg", func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "GET", r.Method)
+		w.Header().Set("Content-Type", "image/jpeg")
 		_, _ = fmt.Fprint(w, "yey")
 	})
 
-	offerStore := store.NewOfferFileStore(&MockEngine{sync.Mutex{}, fstest.MapFS{}})
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
 
 	notifier := MockWriter{}
-	httpClient := http.Client{}
 	clock := MockClock{}
 	cmd := OffersUpdatesCommand{}
 	cmd.SetCommon(CommonOpts{
@@ -59,7 +68,7 @@ func TestOffersUpdatesCommand_Execute(t *testing.T) {
 		OfferStore:       offerStore,
 		OfferWriter:      &notifier,
 		Clock:            clock,
-		HttpClient:       httpClient,
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
 	})
 	p := flags.NewParser(&cmd, flags.Default)
 	_, err := p.ParseArgs([]string{
@@ -84,6 +93,55 @@ func TestOffersUpdatesCommand_Execute(t *testing.T) {
 	})
 }
 
+func TestOffersUpdatesCommand_Execute_ImageNotAvailable(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		_, _ = fmt.Fprintf(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},"+
+			"	\"main_image\":{\"m_img_375x211\":\"%s/1.jpg\"},"+
+			"	\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"region\":{\"full_name\":\"małopolskie, Kraków, Bronowice\"},"+
+			"	\"stats\":{\"ranges_area_max\":180,\"ranges_area_min\":180,\"ranges_price_max\":1450000,\"ranges_price_min\":1450000}}],"+
+			"\"count\":1,\"page\":1,\"page_size\":1,\"next\":null,\"previous\":null}",
+			server.URL)
+	})
+	mux.HandleFunc("/1.jpg", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>not found</html>", http.StatusNotFound)
+	})
+
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
+
+	notifier := MockWriter{}
+	clock := MockClock{}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       offerStore,
+		OfferWriter:      &notifier,
+		Clock:            clock,
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{
+		"--request.regions=1",
+	})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, notifier.called, []writer.Message{
+		{
+			Text: "🏡Wille Acme\n📍 małopolskie, Kraków, Bronowice\n📏 180-180\n🙀 1450000-1450000\n\n➡️ " + server.URL + "/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1",
+		},
+	})
+}
+
 func TestOffersUpdatesCommand_Execute_NoPriceChange(t *testing.T) {
 	mux := http.NewServeMux()
 	server := httptest.NewServer(mux)
@@ -118,13 +176,13 @@ func TestOffersUpdatesCommand_Execute_NoPriceChange(t *testing.T) {
 	})
 	mux.HandleFunc("/1.jpg", func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "GET", r.Method)
+		w.Header().Set("Content-Type", "image/jpeg")
 		_, _ = fmt.Fprint(w, "yay")
 	})
 
-	offerStore := store.NewOfferFileStore(&MockEngine{sync.Mutex{}, fstest.MapFS{}})
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
 
 	notifier := MockWriter{}
-	httpClient := http.Client{}
 	clock := MockClock{}
 	cmd := OffersUpdatesCommand{}
 	cmd.SetCommon(CommonOpts{
@@ -133,7 +191,7 @@ func TestOffersUpdatesCommand_Execute_NoPriceChange(t *testing.T) {
 		OfferStore:       offerStore,
 		OfferWriter:      &notifier,
 		Clock:            clock,
-		HttpClient:       httpClient,
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
 	})
 	p := flags.NewParser(&cmd, flags.Default)
 	_, err := p.ParseArgs([]string{
@@ -191,13 +249,13 @@ func TestOffersUpdatesCommand_Execute_PriceChange_Rise(t *testing.T) {
 	})
 	mux.HandleFunc("/1.jpg", func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "GET", r.Method)
+		w.Header().Set("Content-Type", "image/jpeg")
 		_, _ = fmt.Fprint(w, "yay")
 	})
 
-	offerStore := store.NewOfferFileStore(&MockEngine{sync.Mutex{}, fstest.MapFS{}})
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
 
 	notifier := MockWriter{}
-	httpClient := http.Client{}
 	clock := MockClock{}
 	cmd := OffersUpdatesCommand{}
 	cmd.SetCommon(CommonOpts{
@@ -206,7 +264,7 @@ func TestOffersUpdatesCommand_Execute_PriceChange_Rise(t *testing.T) {
 		OfferStore:       offerStore,
 		OfferWriter:      &notifier,
 		Clock:            clock,
-		HttpClient:       httpClient,
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
 	})
 	p := flags.NewParser(&cmd, flags.Default)
 	_, err := p.ParseArgs([]string{
@@ -228,9 +286,10 @@ func TestOffersUpdatesCommand_Execute_PriceChange_Rise(t *testing.T) {
 			Text:  "🏡Wille Acme\n📍 małopolskie, Kraków, Bronowice\n📏 180-180\n🙀 1450000-1450000\n\n➡️ " + server.URL + "/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1",
 		},
 		{
-			Title: "",
-			Image: make([]byte, 0),
-			Text:  "➡️ " + server.URL + "/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1\n\n↗️ 1550000-1750000",
+			Title:   "",
+			Image:   make([]byte, 0),
+			Text:    "➡️ " + server.URL + "/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1\n\n↗️ 1550000-1750000",
+			ReplyTo: "ref-1",
 		},
 	})
 }
@@ -269,13 +328,13 @@ func TestOffersUpdatesCommand_Execute_PriceChange_Drop(t *testing.T) {
 	})
 	mux.HandleFunc("/1.jpg", func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "GET", r.Method)
+		w.Header().Set("Content-Type", "image/jpeg")
 		_, _ = fmt.Fprint(w, "yay")
 	})
 
-	offerStore := store.NewOfferFileStore(&MockEngine{sync.Mutex{}, fstest.MapFS{}})
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
 
 	notifier := MockWriter{}
-	httpClient := http.Client{}
 	clock := MockClock{}
 	cmd := OffersUpdatesCommand{}
 	cmd.SetCommon(CommonOpts{
@@ -284,7 +343,7 @@ func TestOffersUpdatesCommand_Execute_PriceChange_Drop(t *testing.T) {
 		OfferStore:       offerStore,
 		OfferWriter:      &notifier,
 		Clock:            clock,
-		HttpClient:       httpClient,
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
 	})
 	p := flags.NewParser(&cmd, flags.Default)
 	_, err := p.ParseArgs([]string{
@@ -306,57 +365,817 @@ func TestOffersUpdatesCommand_Execute_PriceChange_Drop(t *testing.T) {
 			Text:  "🏡Wille Acme\n📍 małopolskie, Kraków, Bronowice\n📏 180-180\n🙀 1450000-1450000\n\n➡️ " + server.URL + "/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1",
 		},
 		{
-			Title: "",
-			Image: make([]byte, 0),
-			Text:  "➡️ " + server.URL + "/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1\n\n↘️ 950000-1150000",
+			Title:   "",
+			Image:   make([]byte, 0),
+			Text:    "➡️ " + server.URL + "/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1\n\n↘️ 950000-1150000",
+			ReplyTo: "ref-1",
 		},
 	})
 }
 
-type MockEngine struct {
-	m  sync.Mutex
-	fs fstest.MapFS
+func TestOffersUpdatesCommand_Execute_ImageChange(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		_, _ = fmt.Fprintf(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},"+
+			"	\"main_image\":{\"m_img_375x211\":\"%s/1.jpg\"},"+
+			"	\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"region\":{\"full_name\":\"małopolskie, Kraków, Bronowice\"},"+
+			"	\"stats\":{\"ranges_area_max\":180,\"ranges_area_min\":180,\"ranges_price_max\":1450000,\"ranges_price_min\":1450000}}],"+
+			"\"count\":1,\"page\":1,\"page_size\":1,\"next\":null,\"previous\":null}",
+			server.URL)
+	})
+	image := "yay"
+	// unavailable serves the image once, so it is detected as changed but can't be attached to the notification
+	unavailable := false
+	mux.HandleFunc("/1.jpg", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		if unavailable && image == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = fmt.Fprint(w, image)
+		if unavailable {
+			image = ""
+		}
+	})
+
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
+
+	notifier := MockWriter{}
+	clock := MockClock{}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       offerStore,
+		OfferWriter:      &notifier,
+		Clock:            clock,
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{
+		"--request.regions=1",
+		"--track-image-changes",
+	})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	// Request again with the same image
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	// Request again and receive changed image
+	image = "yey"
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	// Request again and receive changed image which can't be downloaded for the notification
+	image, unavailable = "yoy", true
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, notifier.called, []writer.Message{
+		{
+			Title: server.URL + "/1.jpg",
+			Image: []byte("yay"),
+			Text:  "🏡Wille Acme\n📍 małopolskie, Kraków, Bronowice\n📏 180-180\n🙀 1450000-1450000\n\n➡️ " + server.URL + "/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1",
+		},
+		{
+			Title:   server.URL + "/1.jpg",
+			Image:   []byte("yey"),
+			Text:    "➡️ " + server.URL + "/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1\n\n🖼 main image changed",
+			ReplyTo: "ref-1",
+		},
+		{
+			Text:    "➡️ " + server.URL + "/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1\n\n🖼 main image changed: " + server.URL + "/1.jpg",
+			ReplyTo: "ref-1",
+		},
+	})
 }
 
-func (m *MockEngine) Read(path string) ([]byte, error) {
-	m.m.Lock()
-	defer m.m.Unlock()
+func TestOffersUpdatesCommand_Execute_Summary(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
 
-	if m.fs[path] == nil {
-		return make([]byte, 0), file.NoPathError(path)
-	}
+	requestIdx := 0
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		priceMax := 1450000
+		if requestIdx > 0 {
+			priceMax = 1550000
+		}
+		requestIdx++
+		_, _ = fmt.Fprintf(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},"+
+			"	\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"stats\":{\"ranges_area_max\":180,\"ranges_area_min\":180,\"ranges_price_max\":%d,\"ranges_price_min\":1450000}},"+
+			"{\"id\":2,\"vendor\":{\"slug\":\"property-foo-bar\"},"+
+			"	\"name\":\"Wille Acme\",\"slug\":\"foo-acme-krakow-zwierzyniec\","+
+			"	\"stats\":{\"ranges_area_max\":373,\"ranges_area_min\":139,\"ranges_price_max\":0,\"ranges_price_min\":0}}],"+
+			"\"count\":2,\"page\":1,\"page_size\":2,\"next\":null,\"previous\":null}",
+			priceMax)
+	})
 
-	return m.fs[path].Data, nil
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
+
+	notifier := MockWriter{}
+	clock := MockClock{}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       offerStore,
+		OfferWriter:      &notifier,
+		Clock:            clock,
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	summaryFile := filepath.Join(t.TempDir(), "summary.json")
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{
+		"--request.regions=1",
+		"--summary.file=" + summaryFile,
+		"--summary.notify",
+	})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	// Request again and receive changed price of the first offer
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	b, err := ioutil.ReadFile(summaryFile)
+	require.NoError(t, err)
+	var summary RunSummary
+	require.NoError(t, json.Unmarshal(b, &summary))
+	assert.Equal(t, int64(1), summary.RegionsProcessed)
+	assert.Equal(t, int64(2), summary.OffersFetched)
+	assert.Equal(t, int64(0), summary.New)
+	assert.Equal(t, int64(1), summary.Risen)
+	assert.Equal(t, int64(0), summary.Dropped)
+	assert.Equal(t, int64(1), summary.Unchanged)
+	assert.Equal(t, int64(0), summary.NotificationFailures)
+	assert.Contains(t, summary.StageSeconds, "persist")
+
+	require.Len(t, notifier.called, 5)
+	assert.Contains(t, notifier.called[4].Text, "risen: 1")
 }
 
-func (m *MockEngine) Exists(path string) (bool, error) {
-	m.m.Lock()
-	defer m.m.Unlock()
+func TestOffersUpdatesCommand_Execute_ErrorThreshold(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
 
-	return m.fs[path] != nil, nil
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\"},"+
+			"{\"id\":2,\"vendor\":{\"slug\":\"property-foo-bar\"},\"name\":\"Wille Acme\",\"slug\":\"foo-acme-krakow-zwierzyniec\"},"+
+			"{\"id\":3,\"vendor\":{\"slug\":\"property-foo-bar\"},\"name\":\"Wille Acme\",\"slug\":\"foo-acme-krakow-debniki\"}],"+
+			"\"count\":3,\"page\":1,\"page_size\":3,\"next\":null,\"previous\":null}")
+	})
+
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
+
+	notifier := MockWriter{err: errors.New("telegram is down")}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       offerStore,
+		OfferWriter:      &notifier,
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{
+		"--request.regions=1",
+		"--error-threshold.ratio=0.2",
+		"--error-threshold.min-offers=1",
+	})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.Error(t, err)
+	assert.Equal(t, ExitAborted, ExitCode(err))
+	assert.Len(t, notifier.called, 1, "run is aborted after the first failure")
 }
 
-func (m *MockEngine) Write(path string, bytes []byte) error {
-	m.m.Lock()
-	defer m.m.Unlock()
+func TestOffersUpdatesCommand_Execute_Summary_EmptyLastPage(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
 
-	m.fs[path] = &fstest.MapFile{
-		Data: bytes,
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "{\"results\":[{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},\"slug\":\"wille-acme\"}],"+
+			"\"count\":1,\"page\":1,\"page_size\":1,\"next\":\"%s/page-2\",\"previous\":null}", server.URL)
+	})
+	mux.HandleFunc("/page-2", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "{\"results\":[],\"count\":1,\"page\":2,\"page_size\":1,\"next\":\"%s/page-3\",\"previous\":null}", server.URL)
+	})
+
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       store.NewOfferFileStore(memory.NewEngine()),
+		OfferWriter:      &MockWriter{},
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	summaryFile := filepath.Join(t.TempDir(), "summary.json")
+	_, err := flags.NewParser(&cmd, flags.Default).ParseArgs([]string{
+		"--request.regions=1",
+		"--summary.file=" + summaryFile,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, cmd.Execute(nil))
+
+	b, err := ioutil.ReadFile(summaryFile)
+	require.NoError(t, err)
+	var summary RunSummary
+	require.NoError(t, json.Unmarshal(b, &summary))
+	assert.Equal(t, int64(1), summary.RegionsProcessed, "region ending with an empty page is processed")
+	assert.Equal(t, int64(1), summary.OffersFetched)
+}
+
+func TestOffersUpdatesCommand_Execute_RegionNames(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var requested []string
+	mux.HandleFunc("/s/v2/regions/region", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":[{\"id\":52258,\"name\":\"Kraków\",\"full_name\":\"małopolskie, Kraków\",\"type\":4}]}")
+	})
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Query().Get("region"))
+		_, _ = fmt.Fprint(w, "{\"results\":[],\"count\":0,\"page\":1,\"page_size\":50,\"next\":null,\"previous\":null}")
+	})
+
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       store.NewOfferFileStore(memory.NewEngine()),
+		OfferWriter:      &MockWriter{},
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	_, err := flags.NewParser(&cmd, flags.Default).ParseArgs([]string{"--request.regions=120", "--request.regions=kraków"})
+	require.NoError(t, err)
+
+	require.NoError(t, cmd.Execute(nil))
+	assert.ElementsMatch(t, []string{"120", "52258"}, requested)
+
+	_, err = flags.NewParser(&cmd, flags.Default).ParseArgs([]string{"--request.regions=Krak"})
+	require.NoError(t, err)
+	err = cmd.Execute(nil)
+	assert.Equal(t, ExitConfig, ExitCode(err))
+	assert.EqualError(t, err, "config: request regions: region \"Krak\" not found")
+}
+
+func TestOffersUpdatesCommand_Execute_FailOn(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tbl := []struct {
+		failOn string
+		code   int
+	}{
+		{FailOnAny, ExitApi},
+		{FailOnApi, ExitApi},
+		{FailOnStorage, ExitOk},
+		{FailOnNone, ExitOk},
+	}
+
+	for _, tt := range tbl {
+		cmd := OffersUpdatesCommand{}
+		cmd.SetCommon(CommonOpts{
+			PrimaryMarketAPI: api.NewHttpApi(server.URL),
+			PrimaryMarketURL: server.URL,
+			OfferStore:       store.NewOfferFileStore(memory.NewEngine()),
+			OfferWriter:      &MockWriter{},
+			Clock:            MockClock{},
+			ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+		})
+		p := flags.NewParser(&cmd, flags.Default)
+		_, err := p.ParseArgs([]string{
+			"--request.regions=1",
+			"--fail-on=" + tt.failOn,
+		})
+		require.NoError(t, err)
+
+		err = cmd.Execute(nil)
+		assert.Equal(t, tt.code, ExitCode(err), tt.failOn)
+	}
+}
+
+func TestOffersUpdatesCommand_Run_FailOnHealth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tbl := []struct {
+		failOn  string
+		healthy bool
+	}{
+		{FailOnAny, false},
+		{FailOnApi, false},
+		{FailOnStorage, true},
+		{FailOnNone, true},
+	}
+
+	for _, tt := range tbl {
+		monitor := health.NewMonitor(MockClock{}, 0, 0, 1)
+		cmd := OffersUpdatesCommand{}
+		cmd.SetCommon(CommonOpts{
+			PrimaryMarketAPI: api.NewHttpApi(server.URL),
+			PrimaryMarketURL: server.URL,
+			OfferStore:       store.NewOfferFileStore(memory.NewEngine()),
+			OfferWriter:      &MockWriter{},
+			Clock:            MockClock{},
+			ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+			Health:           monitor,
+		})
+		p := flags.NewParser(&cmd, flags.Default)
+		_, err := p.ParseArgs([]string{
+			"--request.regions=1",
+			"--fail-on=" + tt.failOn,
+		})
+		require.NoError(t, err)
+		cmd.regions = []int64{1}
+
+		require.Error(t, cmd.run(), "run reports the failure regardless of the policy")
+		assert.Equal(t, tt.healthy, monitor.Healthy() == nil, tt.failOn)
 	}
-	return nil
+}
+
+func TestOffersUpdatesCommand_Run_Snapshot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":[{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},\"slug\":\"wille-acme\"}],"+
+			"\"count\":1,\"page\":1,\"page_size\":1,\"next\":null,\"previous\":null}")
+	}))
+	defer server.Close()
+
+	snapshot := filepath.Join(t.TempDir(), "state.json")
+	eng, err := memory.NewSnapshotEngine(snapshot)
+	require.NoError(t, err)
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       store.NewOfferFileStore(eng),
+		OfferWriter:      &MockWriter{},
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+		Snapshot:         eng.Snapshot,
+	})
+	_, err = flags.NewParser(&cmd, flags.Default).ParseArgs(nil)
+	require.NoError(t, err)
+	cmd.regions = []int64{1}
+
+	require.NoError(t, cmd.run())
+
+	restored, err := memory.NewSnapshotEngine(snapshot)
+	require.NoError(t, err)
+	exists, err := restored.Exists("1.json")
+	require.NoError(t, err)
+	assert.True(t, exists, "records are saved after the run")
+}
+
+func TestOffersUpdatesCommand_Execute_DryRun(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},"+
+			"	\"main_image\":{\"m_img_375x211\":\"%s/1.jpg\"},"+
+			"	\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"stats\":{\"ranges_area_max\":180,\"ranges_area_min\":180,\"ranges_price_max\":1550000,\"ranges_price_min\":1450000}},"+
+			"{\"id\":2,\"vendor\":{\"slug\":\"property-foo-bar\"},"+
+			"	\"name\":\"Wille Acme\",\"slug\":\"foo-acme-krakow-zwierzyniec\","+
+			"	\"stats\":{\"ranges_area_max\":373,\"ranges_area_min\":139,\"ranges_price_max\":0,\"ranges_price_min\":0}}],"+
+			"\"count\":2,\"page\":1,\"page_size\":2,\"next\":null,\"previous\":null}",
+			server.URL)
+	})
+	mux.HandleFunc("/1.jpg", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("dry run must not download images")
+	})
+
+	eng := memory.NewEngineWith(map[string][]byte{
+		"2.json": []byte("{\"id\":2,\"price_min\":0,\"price_max\":0,\"notification_ref\":\"ref-7\"}"),
+	})
+	offerStore := store.NewOfferFileStore(eng)
+
+	notifier := MockWriter{}
+	snapshots, prunes := 0, 0
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       offerStore,
+		OfferWriter:      &notifier,
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+		Snapshot: func() error {
+			snapshots++
+			return nil
+		},
+		PruneImages: func() error {
+			prunes++
+			return nil
+		},
+	})
+	var out bytes.Buffer
+	cmd.out = &out
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{
+		"--request.regions=1",
+		"--track-image-changes",
+		"--dry-run",
+		"--dry-run-format=json",
+	})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	assert.Empty(t, notifier.called)
+	assert.Len(t, eng.Records(), 1, "store is not modified")
+	assert.Equal(t, 0, snapshots, "snapshot is not saved")
+	assert.Equal(t, 0, prunes, "cached images are not pruned")
+
+	var report dryRunReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	require.Len(t, report.Messages, 1)
+	assert.Equal(t, server.URL+"/1.jpg", report.Messages[0].ImageUrl)
+	assert.Contains(t, report.Messages[0].Text, "🙀 1450000-1550000")
+	require.Len(t, report.Saved, 1)
+	assert.Equal(t, int64(1), report.Saved[0].Id)
+	assert.Equal(t, "dry-run-1", report.Saved[0].NotificationRef)
+}
+
+func TestOffersUpdatesCommand_Execute_Seed(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"stats\":{\"ranges_area_max\":180,\"ranges_area_min\":180,\"ranges_price_max\":1550000,\"ranges_price_min\":1450000}},"+
+			"{\"id\":2,\"vendor\":{\"slug\":\"property-foo-bar\"},\"name\":\"Wille Acme\",\"slug\":\"foo-acme-krakow-zwierzyniec\"}],"+
+			"\"count\":2,\"page\":1,\"page_size\":2,\"next\":null,\"previous\":null}")
+	})
+
+	eng := memory.NewEngineWith(map[string][]byte{
+		"1.json": []byte("{\"id\":1,\"price_min\":1450000,\"price_max\":1450000,\"notification_ref\":\"ref-7\"}"),
+	})
+	offerStore := store.NewOfferFileStore(eng)
+
+	notifier := MockWriter{}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       offerStore,
+		OfferWriter:      &notifier,
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{
+		"--request.regions=1",
+		"--seed",
+	})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	// only the missing offer is seeded, the price rise of the stored one is notified as usual
+	assert.Equal(t, int64(1), cmd.summary.Seeded)
+	assert.Equal(t, int64(1), cmd.summary.Risen)
+	require.Len(t, notifier.called, 1)
+	assert.Equal(t, "ref-7", notifier.called[0].ReplyTo)
+
+	stored, err := offerStore.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1550000), stored.PriceMax)
+	assert.Equal(t, "ref-7", stored.NotificationRef)
+	_, err = offerStore.Get(2)
+	require.NoError(t, err)
+
+	cmd.Watch = time.Minute
+	assert.Equal(t, ExitConfig, ExitCode(cmd.Execute(nil)))
+}
+
+func TestOffersUpdatesCommand_Execute_Profiles(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "{\"results\":["+
+			"{\"id\":%[1]s1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"stats\":{\"ranges_area_max\":180,\"ranges_area_min\":180,\"ranges_price_max\":1450000,\"ranges_price_min\":1450000}},"+
+			"{\"id\":%[1]s2,\"vendor\":{\"slug\":\"property-foo-bar\"},\"name\":\"Wille Acme\",\"slug\":\"foo-acme-krakow-zwierzyniec\","+
+			"	\"stats\":{\"ranges_area_max\":80,\"ranges_area_min\":40,\"ranges_price_max\":850000,\"ranges_price_min\":450000}}],"+
+			"\"count\":2,\"page\":1,\"page_size\":2,\"next\":null,\"previous\":null}",
+			r.URL.Query().Get("region"))
+	})
+
+	eng := memory.NewEngine()
+	family := MockWriter{}
+	investment := MockWriter{}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       store.NewOfferFileStore(eng),
+		OfferWriter:      &MockWriter{},
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+		Profiles: []Profile{
+			{
+				Name:        "krakow-family",
+				Regions:     []int64{1},
+				Filter:      filter.Options{PriceMax: 900000, AreaMin: 60},
+				OfferWriter: &family,
+				OfferStore:  store.NewPrefixedOfferFileStore(eng, "krakow-family-"),
+			},
+			{
+				Name:        "warsaw-investment",
+				Regions:     []int64{2},
+				OfferWriter: &investment,
+				OfferStore:  store.NewPrefixedOfferFileStore(eng, "warsaw-investment-"),
+			},
+		},
+	})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--profile=krakow-family"})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	require.Len(t, family.called, 1)
+	assert.Contains(t, family.called[0].Text, "📏 40-80")
+	assert.Empty(t, investment.called)
+	assert.Equal(t, int64(1), cmd.summary.SkippedByFilter)
+	assert.Equal(t, "krakow-family", cmd.summary.Profile)
+	assert.NotNil(t, eng.Records()["krakow-family-12.json"])
+
+	_, err = p.ParseArgs([]string{"--profile=warsaw-investment", "--profile=krakow-family"})
+	require.NoError(t, err)
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+	assert.Len(t, family.called, 1)
+	assert.Len(t, investment.called, 2)
+
+	_, err = p.ParseArgs([]string{"--profile=unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, ExitConfig, ExitCode(cmd.Execute(nil)))
+
+	_, err = p.ParseArgs([]string{"--request.regions=3"})
+	require.NoError(t, err)
+	assert.Equal(t, ExitConfig, ExitCode(cmd.Execute(nil)), "regions are not silently replaced by profiles")
+}
+
+func TestOffersUpdatesCommand_Execute_ProfilesFallback(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":["+
+			"{\"id\":12,\"vendor\":{\"slug\":\"property-foo-bar\"},\"name\":\"Wille Acme\",\"slug\":\"foo-acme-krakow-zwierzyniec\","+
+			"	\"stats\":{\"ranges_area_max\":80,\"ranges_area_min\":40,\"ranges_price_max\":850000,\"ranges_price_min\":450000}}],"+
+			"\"count\":1,\"page\":1,\"page_size\":1,\"next\":null,\"previous\":null}")
+	})
+
+	eng := memory.NewEngine()
+	notifier := MockWriter{}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       store.NewOfferFileStore(eng),
+		OfferWriter:      &notifier,
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--request.regions=1"})
+	require.NoError(t, err)
+	require.NoError(t, cmd.Execute(nil))
+	require.Len(t, notifier.called, 1)
+
+	family := MockWriter{}
+	cmd.Profiles = []Profile{{
+		Name:        "krakow-family",
+		Regions:     []int64{1},
+		OfferWriter: &family,
+		OfferStore:  store.NewFallbackOfferFileStore(eng, "krakow-family-"),
+	}}
+	cmd.PropertiesRequest.Regions = nil
+	require.NoError(t, cmd.Execute(nil))
+
+	assert.Empty(t, family.called, "offers stored before profiles are known")
+	assert.Equal(t, int64(1), cmd.summary.Unchanged)
+}
+
+func TestOffersUpdatesCommand_Execute_Details(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"region\":{\"full_name\":\"małopolskie, Kraków, Bronowice\"},"+
+			"	\"stats\":{\"ranges_area_max\":180,\"ranges_area_min\":180,\"ranges_price_max\":1450000,\"ranges_price_min\":1450000}}],"+
+			"\"count\":1,\"page\":1,\"page_size\":1,\"next\":null,\"previous\":null}")
+	})
+	mux.HandleFunc("/s/v2/offers/offer/1", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"id\":1,\"address\":\"ul. Zielona 1\","+
+			"\"geo_point\":{\"coordinates\":[19.89,50.08]},"+
+			"\"construction_date_range\":{\"lower\":\"2021-03-01\",\"upper\":\"2022-12-31\"},"+
+			"\"stats\":{\"properties_count_for_sale\":12},"+
+			"\"vendor\":{\"name\":\"Bar Sp. z o.o.\"}}")
+	})
+
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
+	notifier := MockWriter{}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       offerStore,
+		OfferWriter:      &notifier,
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{
+		"--request.regions=1",
+		"--details.notify",
+	})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	require.Len(t, notifier.called, 1)
+	assert.Equal(t, "🏡Wille Acme\n📍 małopolskie, Kraków, Bronowice\n📏 180-180\n🙀 1450000-1450000\n"+
+		"📌 ul. Zielona 1\n🏗 Bar Sp. z o.o.\n🗓 2022-12-31\n🔑 12\n"+
+		"\n➡️ "+server.URL+"/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1", notifier.called[0].Text)
+
+	stored, err := offerStore.Get(1)
+	require.NoError(t, err)
+	require.NotNil(t, stored.Details)
+	assert.Equal(t, 50.08, stored.Details.Latitude)
+	assert.Equal(t, 19.89, stored.Details.Longitude)
+}
+
+func TestOffersUpdatesCommand_Execute_Near(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"region\":{\"full_name\":\"małopolskie, Kraków, Bronowice\"},\"geo_point\":{\"coordinates\":[19.89,50.08]},"+
+			"	\"stats\":{\"ranges_area_max\":180,\"ranges_area_min\":180,\"ranges_price_max\":0,\"ranges_price_min\":0}},"+
+			"{\"id\":2,\"vendor\":{\"slug\":\"property-foo-bar\"},\"name\":\"Foo Acme\",\"slug\":\"foo-acme-wieliczka\","+
+			"	\"region\":{\"full_name\":\"małopolskie, Wieliczka\"},\"geo_point\":{\"coordinates\":[20.06,49.98]},"+
+			"	\"stats\":{\"ranges_area_max\":90,\"ranges_area_min\":40,\"ranges_price_max\":0,\"ranges_price_min\":0}},"+
+			"{\"id\":3,\"vendor\":{\"slug\":\"property-foo-bar\"},\"name\":\"Baz Acme\",\"slug\":\"baz-acme-krakow\","+
+			"	\"region\":{\"full_name\":\"małopolskie, Kraków\"},"+
+			"	\"stats\":{\"ranges_area_max\":90,\"ranges_area_min\":40,\"ranges_price_max\":0,\"ranges_price_min\":0}},"+
+			"{\"id\":4,\"vendor\":{\"slug\":\"property-foo-bar\"},\"name\":\"Qux Acme\",\"slug\":\"qux-acme-krakow\","+
+			"	\"region\":{\"full_name\":\"małopolskie, Kraków\"},"+
+			"	\"stats\":{\"ranges_area_max\":90,\"ranges_area_min\":40,\"ranges_price_max\":0,\"ranges_price_min\":0}}],"+
+			"\"count\":4,\"page\":1,\"page_size\":4,\"next\":null,\"previous\":null}")
+	})
+
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
+	// listed without coordinates, located with details of the stored offer
+	require.NoError(t, offerStore.Save(store.Offer{Id: 3, AreaMin: 40, AreaMax: 90,
+		Details: &store.OfferDetails{Latitude: 50.06, Longitude: 19.94}}))
+	notifier := MockWriter{}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       offerStore,
+		OfferWriter:      &notifier,
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{
+		"--request.regions=1",
+		"--filter.near=50.0614,19.9366,5,Rynek",
+	})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	require.Len(t, notifier.called, 1)
+	assert.Equal(t, "🏡Wille Acme\n📍 małopolskie, Kraków, Bronowice\n📏 180-180\n"+
+		"📐 Rynek: 3.9 km\n"+
+		"\n➡️ "+server.URL+"/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1", notifier.called[0].Text)
+
+	stored, err := offerStore.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, 50.08, stored.Latitude)
+	assert.Equal(t, 19.89, stored.Longitude)
+	assert.Equal(t, int64(1), cmd.summary.SkippedByFilter)
+	assert.Equal(t, int64(1), cmd.summary.SkippedNoCoordinates)
+	assert.Equal(t, int64(1), cmd.summary.Unchanged)
+}
+
+func TestOffersUpdatesCommand_Execute_Neighbourhoods(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"region\":{\"full_name\":\"małopolskie, Kraków, Bronowice\"},\"geo_point\":{\"coordinates\":[19.89,50.08]},"+
+			"	\"stats\":{\"ranges_area_max\":180,\"ranges_area_min\":180,\"ranges_price_max\":0,\"ranges_price_min\":0}},"+
+			"{\"id\":2,\"vendor\":{\"slug\":\"property-foo-bar\"},\"name\":\"Foo Acme\",\"slug\":\"foo-acme-wieliczka\","+
+			"	\"region\":{\"full_name\":\"małopolskie, Wieliczka\"},\"geo_point\":{\"coordinates\":[20.06,49.98]},"+
+			"	\"stats\":{\"ranges_area_max\":90,\"ranges_area_min\":40,\"ranges_price_max\":0,\"ranges_price_min\":0}}],"+
+			"\"count\":2,\"page\":1,\"page_size\":2,\"next\":null,\"previous\":null}")
+	})
+
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
+	notifier := MockWriter{}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       offerStore,
+		OfferWriter:      &notifier,
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{
+		"--request.regions=1",
+		"--filter.neighbourhoods=../filter/testdata/neighbourhoods.geojson",
+	})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	require.Len(t, notifier.called, 1)
+	assert.Equal(t, "🏡Wille Acme\n📍 małopolskie, Kraków, Bronowice\n🗺 Bronowice\n📏 180-180\n"+
+		"\n➡️ "+server.URL+"/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1", notifier.called[0].Text)
+
+	stored, err := offerStore.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, "Bronowice", stored.Neighbourhood)
+	_, err = offerStore.Get(2)
+	assert.Error(t, err)
 }
 
 type MockWriter struct {
 	m      sync.Mutex
 	called []writer.Message
+	err    error
 }
 
-func (m *MockWriter) Write(offer writer.Message) error {
+func (m *MockWriter) Write(offer writer.Message) (string, error) {
 	m.m.Lock()
 	defer m.m.Unlock()
 
 	m.called = append(m.called, offer)
-	return nil
+	if m.err != nil {
+		return "", m.err
+	}
+	return "ref-" + strconv.Itoa(len(m.called)), nil
 }
 
 type MockClock struct {
@@ -366,3 +1185,80 @@ type MockClock struct {
 func (m MockClock) Now() time.Time {
 	return m.time
 }
+
+func TestOffersUpdatesCommand_Execute_QuarantineCorrupted(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"stats\":{\"ranges_area_max\":180,\"ranges_area_min\":180,\"ranges_price_max\":1550000,\"ranges_price_min\":1450000}}],"+
+			"\"count\":1,\"page\":1,\"page_size\":1,\"next\":null,\"previous\":null}")
+	})
+
+	tbl := []struct {
+		quarantine bool
+		code       int
+	}{
+		{false, ExitStorage},
+		{true, ExitOk},
+	}
+
+	for _, tt := range tbl {
+		corrupted := []byte("{\"id\":1,\"price_min\":14500")
+		eng := memory.NewEngineWith(map[string][]byte{
+			"1.json": corrupted,
+		})
+		offerStore := store.NewOfferFileStore(eng)
+
+		_, err := offerStore.Get(1)
+		var corruptedErr *store.CorruptedRecordError
+		require.True(t, errors.As(err, &corruptedErr))
+		assert.Equal(t, "1.json", corruptedErr.Path)
+
+		notifier := MockWriter{}
+		cmd := OffersUpdatesCommand{}
+		cmd.SetCommon(CommonOpts{
+			PrimaryMarketAPI: api.NewHttpApi(server.URL),
+			PrimaryMarketURL: server.URL,
+			OfferStore:       offerStore,
+			OfferWriter:      &notifier,
+			Clock:            MockClock{},
+			ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+		})
+		args := []string{"--request.regions=1"}
+		if tt.quarantine {
+			args = append(args, "--quarantine-corrupted")
+		}
+		p := flags.NewParser(&cmd, flags.Default)
+		_, err = p.ParseArgs(args)
+		require.NoError(t, err)
+
+		err = cmd.Execute(nil)
+		assert.Equal(t, tt.code, ExitCode(err))
+		assert.Empty(t, notifier.called)
+
+		if !tt.quarantine {
+			assert.Equal(t, int64(0), cmd.summary.Quarantined)
+			b, err := eng.Read("1.json")
+			require.NoError(t, err)
+			assert.Equal(t, corrupted, b)
+			continue
+		}
+
+		assert.Equal(t, int64(1), cmd.summary.Quarantined)
+		b, err := eng.Read("quarantine-1.json")
+		require.NoError(t, err)
+		assert.Equal(t, corrupted, b)
+
+		replaced, err := offerStore.Get(1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1550000), replaced.PriceMax)
+
+		offers, err := offerStore.List()
+		require.NoError(t, err)
+		assert.Len(t, offers, 1)
+	}
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/api"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/metrics"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/writer"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// propertiesConcurrency limits offers whose properties are fetched at the same time
+const propertiesConcurrency = 4
+
+// writePropertyChanges compares properties of offers with stored ones, writes changes as a reply to the first offer
+// notification and stores current properties. Properties of offers seen for the first time or seeded are stored
+// silently. Offers are received without waiting for properties of previous ones, so paginated properties requests
+// don't hold up orchestration. The returned channel receives no offers, it is closed when all offers are processed.
+func (cmd *OffersUpdatesCommand) writePropertyChanges(errCh chan<- error, offerCh <-chan store.Offer) <-chan store.Offer {
+	logging.With(logging.Fields{"stage": "properties"}).Printf("[DEBUG] Tracking offers properties..")
+
+	doneCh := make(chan store.Offer)
+	go func() {
+		defer close(doneCh)
+		defer cmd.summary.stageFinished("properties", time.Now())
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, propertiesConcurrency)
+		for offer := range offerCh {
+			offer := offer
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				if !cmd.threshold.exceeded() {
+					cmd.trackProperties(errCh, offer)
+				}
+			}()
+		}
+		wg.Wait()
+	}()
+	return doneCh
+}
+
+// trackProperties fetches properties of the offer, notifies about their changes unless seeding and stores them
+func (cmd *OffersUpdatesCommand) trackProperties(errCh chan<- error, offer store.Offer) {
+	logger := logging.With(logging.Fields{"stage": "properties", "offer_id": offer.Id})
+	logger.Printf("[DEBUG] Getting properties of offer id %v..", offer.Id)
+
+	apiProperties, err := cmd.PrimaryMarketAPI.GetOfferProperties(offer.Id)
+	if err != nil {
+		logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't get properties of offer id %v", offer.Id)
+		errCh <- kindError(KindApi, err)
+		return
+	}
+	properties := mapApiProperties(apiProperties)
+
+	stored, err := cmd.PropertyStore.Get(offer.Id)
+	if err != nil {
+		if !errors.Is(err, engine.ErrNotFound) {
+			logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't get stored properties of offer id %v", offer.Id)
+			cmd.offerFailed(errCh, kindError(KindStorage, err))
+			return
+		}
+		logger.Printf("[DEBUG] Properties of offer id %v are not tracked yet..", offer.Id)
+		stored = nil
+	}
+
+	if stored != nil && !cmd.Seed {
+		if changes := diffProperties(stored, properties); len(changes) > 0 {
+			metrics.OffersRouted.WithLabelValues(metrics.RoutePropertyChange).Inc()
+			cmd.summary.inc(&cmd.summary.PropertyChanged)
+			if _, err := cmd.write(errCh, logger, writer.Message{
+				Text:    "➡️ " + offer.Link + "\n\n" + changes,
+				ReplyTo: offer.NotificationRef,
+			}); err != nil {
+				cmd.offerFailed(errCh, kindError(KindNotification, err))
+				return
+			}
+		}
+	}
+
+	if err := cmd.PropertyStore.Save(offer.Id, properties); err != nil {
+		logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't persist properties of offer id %v", offer.Id)
+		cmd.offerFailed(errCh, kindError(KindStorage, err))
+	}
+}
+
+// mapApiProperties maps to domain structs
+func mapApiProperties(apiProperties []api.Property) []store.Property {
+	properties := make([]store.Property, 0, len(apiProperties))
+	for _, p := range apiProperties {
+		status := store.PropertyAvailable
+		if !p.ForSale {
+			status = store.PropertySold
+		} else if p.IsReserved {
+			status = store.PropertyReserved
+		}
+		properties = append(properties, store.Property{
+			Id:     p.Id,
+			Number: p.Number,
+			Rooms:  p.Rooms,
+			Floor:  p.Floor,
+			Area:   p.Area,
+			Price:  p.Price,
+			Status: status,
+		})
+	}
+	return properties
+}
+
+// diffProperties describes price and status changes of properties, one line per property. Properties missing
+// in current ones are considered sold.
+func diffProperties(stored []store.Property, current []store.Property) string {
+	currentById := map[int64]store.Property{}
+	for _, p := range current {
+		currentById[p.Id] = p
+	}
+	storedById := map[int64]store.Property{}
+	for _, p := range stored {
+		storedById[p.Id] = p
+	}
+
+	txt := ""
+	for _, s := range sortedProperties(stored) {
+		c, ok := currentById[s.Id]
+		if !ok {
+			c = s
+			c.Status = store.PropertySold
+		}
+		switch {
+		case c.Status != s.Status && c.Status == store.PropertySold:
+			txt = txt + "🔒 " + propertyName(s) + " sold\n"
+		case c.Status != s.Status && c.Status == store.PropertyReserved:
+			txt = txt + "⏳ " + propertyName(s) + " reserved\n"
+		case c.Status != s.Status && c.Status == store.PropertyAvailable:
+			txt = txt + "🔓 " + propertyName(s) + " available again for " + strconv.FormatInt(c.Price, 10) + "\n"
+		case c.Price < s.Price && c.Price > 0:
+			txt = txt + "↘️ " + propertyName(s) + " dropped from " + strconv.FormatInt(s.Price, 10) + " to " + strconv.FormatInt(c.Price, 10) + "\n"
+		case c.Price > s.Price && s.Price > 0:
+			txt = txt + "↗️ " + propertyName(s) + " rose from " + strconv.FormatInt(s.Price, 10) + " to " + strconv.FormatInt(c.Price, 10) + "\n"
+		}
+	}
+	for _, c := range sortedProperties(current) {
+		if _, ok := storedById[c.Id]; !ok && c.Status == store.PropertyAvailable {
+			txt = txt + "🆕 " + propertyName(c) + " for " + strconv.FormatInt(c.Price, 10) + "\n"
+		}
+	}
+	return txt
+}
+
+// propertyName describes property as e.g. "3-room 62 m² unit"
+func propertyName(p store.Property) string {
+	return strconv.Itoa(p.Rooms) + "-room " + strconv.FormatFloat(p.Area, 'f', -1, 64) + " m² unit"
+}
+
+func sortedProperties(properties []store.Property) []store.Property {
+	sorted := append([]store.Property(nil), properties...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Id < sorted[j].Id })
+	return sorted
+}
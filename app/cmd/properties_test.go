@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/api"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/media"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/umputun/go-flags"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOffersUpdatesCommand_Execute_Properties(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"stats\":{\"ranges_area_max\":62,\"ranges_area_min\":41,\"ranges_price_max\":780000,\"ranges_price_min\":520000}}],"+
+			"\"count\":1,\"page\":1,\"page_size\":1,\"next\":null,\"previous\":null}")
+	})
+	requestIdx := 0
+	mux.HandleFunc("/s/v2/properties/property", func(w http.ResponseWriter, r *http.Request) {
+		if requestIdx == 0 {
+			_, _ = fmt.Fprint(w, "{\"results\":["+
+				"{\"id\":11,\"rooms\":3,\"area\":62,\"price\":780000,\"for_sale\":true},"+
+				"{\"id\":12,\"rooms\":2,\"area\":41.5,\"price\":520000,\"for_sale\":true}]}")
+		} else if requestIdx == 1 {
+			_, _ = fmt.Fprint(w, "{\"results\":["+
+				"{\"id\":11,\"rooms\":3,\"area\":62,\"price\":740000,\"for_sale\":true},"+
+				"{\"id\":13,\"rooms\":1,\"area\":28,\"price\":390000,\"for_sale\":true}]}")
+		} else {
+			_, _ = fmt.Fprint(w, "{\"results\":["+
+				"{\"id\":11,\"rooms\":3,\"area\":62,\"price\":740000,\"for_sale\":false},"+
+				"{\"id\":13,\"rooms\":1,\"area\":28,\"price\":390000,\"for_sale\":true}]}")
+		}
+		requestIdx++
+	})
+
+	eng := memory.NewEngine()
+	notifier := MockWriter{}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       store.NewOfferFileStore(eng),
+		PropertyStore:    store.NewPropertyFileStore(eng),
+		OfferWriter:      &notifier,
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{
+		"--request.regions=1",
+		"--properties.track",
+	})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+	require.Len(t, notifier.called, 1, "properties of a new offer are stored silently")
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	require.Len(t, notifier.called, 2)
+	assert.Equal(t, "ref-1", notifier.called[1].ReplyTo)
+	assert.Equal(t, "➡️ "+server.URL+"/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1\n\n"+
+		"↘️ 3-room 62 m² unit dropped from 780000 to 740000\n"+
+		"🔒 2-room 41.5 m² unit sold\n"+
+		"🆕 1-room 28 m² unit for 390000\n", notifier.called[1].Text)
+	assert.Equal(t, int64(1), cmd.summary.PropertyChanged)
+
+	stored, err := cmd.PropertyStore.Get(1)
+	require.NoError(t, err)
+	assert.Len(t, stored, 2)
+
+	cmd.Seed = true
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	require.Len(t, notifier.called, 2, "property changes are stored silently when seeding")
+	stored, err = cmd.PropertyStore.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, store.PropertySold, stored[0].Status)
+}
+
+func TestDiffProperties(t *testing.T) {
+	stored := []store.Property{
+		{Id: 1, Rooms: 2, Area: 40, Price: 500000, Status: store.PropertyAvailable},
+		{Id: 2, Rooms: 3, Area: 60, Price: 700000, Status: store.PropertyAvailable},
+		{Id: 3, Rooms: 4, Area: 80, Price: 900000, Status: store.PropertyReserved},
+	}
+	current := []store.Property{
+		{Id: 1, Rooms: 2, Area: 40, Price: 520000, Status: store.PropertyAvailable},
+		{Id: 2, Rooms: 3, Area: 60, Price: 700000, Status: store.PropertyReserved},
+		{Id: 3, Rooms: 4, Area: 80, Price: 880000, Status: store.PropertyAvailable},
+	}
+
+	assert.Equal(t, ""+
+		"↗️ 2-room 40 m² unit rose from 500000 to 520000\n"+
+		"⏳ 3-room 60 m² unit reserved\n"+
+		"🔓 4-room 80 m² unit available again for 880000\n", diffProperties(stored, current))
+	assert.Empty(t, diffProperties(stored, stored))
+}
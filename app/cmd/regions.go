@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/api"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// ApiCommander is implemented by commands which only query the api
+type ApiCommander interface {
+	SetApi(primaryMarketAPI api.Api)
+
+	Execute(args []string) error
+}
+
+type RegionsCommand struct {
+	Search RegionsSearchCommand `command:"search" description:"find region ids by name"`
+}
+
+// RegionsSearchCommand prints regions found by the site's region autocomplete
+type RegionsSearchCommand struct {
+	Args struct {
+		Text []string `positional-arg-name:"text" required:"1"`
+	} `positional-args:"yes"`
+
+	primaryMarketAPI api.Api
+	// out receives found regions, stdout when not set
+	out io.Writer
+}
+
+func (c *RegionsSearchCommand) SetApi(primaryMarketAPI api.Api) {
+	c.primaryMarketAPI = primaryMarketAPI
+}
+
+func (c *RegionsSearchCommand) Execute(_ []string) error {
+	text := strings.Join(c.Args.Text, " ")
+	if strings.TrimSpace(text) == "" {
+		return ConfigError(errors.New("search text is empty"))
+	}
+
+	found, err := c.primaryMarketAPI.SearchRegions(text)
+	if err != nil {
+		return kindError(KindApi, err)
+	}
+
+	out := c.out
+	if out == nil {
+		out = os.Stdout
+	}
+	if len(found) == 0 {
+		_, err = fmt.Fprintf(out, "No regions found for %q\n", text)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tNAME\tFULL NAME\tTYPE")
+	for _, r := range found {
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%d\n", r.Id, r.Name, r.FullName, r.Type)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/umputun/go-flags"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegionsSearchCommand_Execute(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "nowa huta", r.URL.Query().Get("name"))
+		_, _ = fmt.Fprint(w, "{\"results\":[{\"id\":52262,\"name\":\"Nowa Huta\",\"full_name\":\"małopolskie, Kraków, Nowa Huta\",\"type\":6}]}")
+	}))
+	defer server.Close()
+
+	cmd := RegionsSearchCommand{}
+	cmd.SetApi(api.NewHttpApi(server.URL))
+	var out bytes.Buffer
+	cmd.out = &out
+	_, err := flags.NewParser(&cmd, flags.Default).ParseArgs([]string{"nowa", "huta"})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, ""+
+		"ID     NAME       FULL NAME                       TYPE\n"+
+		"52262  Nowa Huta  małopolskie, Kraków, Nowa Huta  6\n", out.String())
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/file"
+	"io"
+	"os"
+)
+
+// StorePathCommander is implemented by commands working with the directory of the file store
+type StorePathCommander interface {
+	SetStorePath(path string)
+
+	Execute(args []string) error
+}
+
+// RelayoutCommand moves records of the file store to another sharding. Other commands use the layout the store was
+// written with, so they must not run meanwhile.
+type RelayoutCommand struct {
+	Levels int `long:"shard-levels" env:"SHARD_LEVELS" description:"nest records in directories named after hashes of their names, 0 moves them to the flat layout"`
+	Width  int `long:"shard-width" env:"SHARD_WIDTH" default:"2" description:"characters of the hash in a shard directory name"`
+
+	storePath string
+	// out receives the relayout report, stdout when not set
+	out io.Writer
+}
+
+func (c *RelayoutCommand) SetStorePath(path string) {
+	c.storePath = path
+}
+
+func (c *RelayoutCommand) Execute(_ []string) error {
+	if c.storePath == "" {
+		return ConfigError(errors.New("fs.store-path is required"))
+	}
+	sharding := file.Sharding{Levels: c.Levels, Width: c.Width}
+	if err := sharding.Validate(); err != nil {
+		return ConfigError(err)
+	}
+
+	moved, err := file.Relayout(c.storePath, sharding)
+	if err != nil {
+		return kindError(KindStorage, err)
+	}
+
+	out := c.out
+	if out == nil {
+		out = os.Stdout
+	}
+	_, _ = fmt.Fprintf(out, "Moved %d records to %d shard levels\n", moved, c.Levels)
+	return nil
+}
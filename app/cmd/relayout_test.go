@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bytes"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/umputun/go-flags"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRelayoutCommand_Execute(t *testing.T) {
+	dir := t.TempDir()
+	eng, err := file.NewSystemEngine(dir)
+	require.NoError(t, err)
+	require.NoError(t, eng.Write("1.json", []byte("{\"id\":1}")))
+
+	cmd := &RelayoutCommand{}
+	var out bytes.Buffer
+	cmd.out = &out
+	cmd.SetStorePath(dir)
+	_, err = flags.NewParser(cmd, flags.Default).ParseArgs([]string{"--shard-levels=1"})
+	require.NoError(t, err)
+
+	require.NoError(t, cmd.Execute(nil))
+	assert.Equal(t, "Moved 1 records to 1 shard levels\n", out.String())
+	assert.NoFileExists(t, filepath.Join(dir, "1.json"))
+
+	// the store is opened with its layout afterwards
+	eng, err = file.NewSystemEngine(dir)
+	require.NoError(t, err)
+	b, err := eng.Read("1.json")
+	require.NoError(t, err)
+	assert.Equal(t, "{\"id\":1}", string(b))
+
+	cmd.Levels = 9
+	assert.Equal(t, ExitConfig, ExitCode(cmd.Execute(nil)))
+	cmd.SetStorePath("")
+	assert.Equal(t, ExitConfig, ExitCode(cmd.Execute(nil)))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2, "layout file and a shard directory")
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"io"
+	"os"
+)
+
+// RewriteCommand reads and writes back every record of the store, so records get the current compression and are
+// encrypted with the current key. Once rewritten, old encryption keys can be retired.
+type RewriteCommand struct {
+	engine engine.Engine
+	// out receives the rewrite report, stdout when not set
+	out io.Writer
+}
+
+func (c *RewriteCommand) SetEngine(eng engine.Engine) {
+	c.engine = eng
+}
+
+func (c *RewriteCommand) Execute(_ []string) error {
+	paths, err := c.engine.List("")
+	if err != nil {
+		return kindError(KindStorage, fmt.Errorf("can't list records: %w", err))
+	}
+
+	logger := logging.With(logging.Fields{"stage": "rewrite"})
+	logger.Printf("[INFO] Rewriting %d records..", len(paths))
+	for i, path := range paths {
+		b, err := c.engine.Read(path)
+		if err != nil {
+			return kindError(KindStorage, fmt.Errorf("can't read %s: %w", path, err))
+		}
+		if err := c.engine.Write(path, b); err != nil {
+			return kindError(KindStorage, fmt.Errorf("can't write %s: %w", path, err))
+		}
+		if (i+1)%100 == 0 {
+			logger.Printf("[INFO] Rewrote %d of %d records", i+1, len(paths))
+		}
+	}
+
+	out := c.out
+	if out == nil {
+		out = os.Stdout
+	}
+	_, _ = fmt.Fprintf(out, "Rewrote %d records\n", len(paths))
+	return nil
+}
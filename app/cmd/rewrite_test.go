@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"bytes"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/encryption"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRewriteCommand_Execute(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	raw := memory.NewEngine()
+	old, err := encryption.NewEngine(raw, [][]byte{oldKey}, false)
+	require.NoError(t, err)
+	require.NoError(t, old.Write("1.json", []byte(`{"id":1}`)))
+	require.NoError(t, old.Write("properties-1.json", []byte(`[]`)))
+
+	rotated, err := encryption.NewEngine(raw, [][]byte{newKey, oldKey}, false)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	cmd := RewriteCommand{out: &out}
+	cmd.SetEngine(rotated)
+	require.NoError(t, cmd.Execute(nil))
+	assert.Equal(t, "Rewrote 2 records\n", out.String())
+
+	retired, err := encryption.NewEngine(raw, [][]byte{newKey}, false)
+	require.NoError(t, err)
+	b, err := retired.Read("1.json")
+	require.NoError(t, err, "records are readable without the old key")
+	assert.Equal(t, []byte(`{"id":1}`), b)
+	b, err = retired.Read("properties-1.json")
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`[]`), b)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/stats"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Stats report formats
+const (
+	StatsFormatTable = "table"
+	StatsFormatJson  = "json"
+)
+
+// StoreCommander is implemented by commands which only work with stored records
+type StoreCommander interface {
+	SetEngine(eng engine.Engine)
+
+	Execute(args []string) error
+}
+
+// ProfilePrefix is a prefix of records of the config file profile, so profiles can share the engine
+func ProfilePrefix(profile string) string {
+	return profile + "-"
+}
+
+// StatsCommand reports price per m² statistics of stored offers per region and per vendor
+type StatsCommand struct {
+	Format  string `long:"format" env:"FORMAT" choice:"table" choice:"json" default:"table" description:"report format"`
+	Profile string `long:"profile" env:"PROFILE" description:"report offers of the config file profile, offers of runs without profiles when not set"`
+
+	engine engine.Engine
+	// out receives the report, stdout when not set
+	out io.Writer
+}
+
+func (c *StatsCommand) SetEngine(eng engine.Engine) {
+	c.engine = eng
+}
+
+func (c *StatsCommand) Execute(_ []string) error {
+	offerStore := store.NewOfferFileStore(c.engine)
+	if c.Profile != "" {
+		offerStore = store.NewPrefixedOfferFileStore(c.engine, ProfilePrefix(c.Profile))
+	}
+	offers, err := listOffers(offerStore, "stats")
+	if err != nil {
+		return kindError(KindStorage, err)
+	}
+	report := stats.Compute(offers)
+
+	out := c.out
+	if out == nil {
+		out = os.Stdout
+	}
+	if c.Format == StatsFormatJson {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	if len(report.Regions) == 0 {
+		_, err = fmt.Fprintln(out, "No offers with known price and area stored")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	printSummaries(tw, "REGION", report.Regions)
+	_, _ = fmt.Fprintln(tw)
+	printSummaries(tw, "VENDOR", report.Vendors)
+	_, _ = fmt.Fprintln(tw)
+	_, _ = fmt.Fprintln(tw, "REGION\tMONTH\tOFFERS\tMEDIAN")
+	for _, s := range report.Regions {
+		for _, p := range s.Trend {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%.0f\n", s.Name, p.Month, p.Count, p.Median)
+		}
+	}
+	return tw.Flush()
+}
+
+func printSummaries(w io.Writer, group string, summaries []stats.Summary) {
+	_, _ = fmt.Fprintf(w, "%s\tOFFERS\tMIN\tP25\tMEDIAN\tP75\tP90\tMAX\tCHANGE\n", group)
+	for _, s := range summaries {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%.0f\t%.0f\t%.0f\t%.0f\t%.0f\t%.0f\t%+.1f%%\n",
+			s.Name, s.Count, s.Min, s.P25, s.Median, s.P75, s.P90, s.Max, s.Change*100)
+	}
+}
+
+// loadRegionMedians calculates region medians of price per m² of stored offers when flagging offers below median
+// is enabled, offers are not flagged when stored offers can't be listed
+func (cmd *OffersUpdatesCommand) loadRegionMedians() {
+	cmd.medians = nil
+	if cmd.BelowMedian.Ratio <= 0 {
+		return
+	}
+
+	logger := logging.With(logging.Fields{"stage": "run"})
+	offers, err := listOffers(cmd.OfferStore, "run")
+	if err != nil {
+		logger.With(logging.Fields{"error": err}).Printf("[WARN] Can't list stored offers, offers below region median won't be flagged")
+		return
+	}
+	cmd.medians = stats.RegionMedians(offers, cmd.BelowMedian.MinOffers)
+	logger.Printf("[DEBUG] Calculated price per m² medians of %d regions", len(cmd.medians))
+}
+
+// belowMedianText describes how much the offer price per m² is below its region median, empty when it is not
+// below by at least the configured ratio
+func (cmd *OffersUpdatesCommand) belowMedianText(offer store.Offer) string {
+	median, ok := cmd.medians[offer.RegionName]
+	if !ok {
+		return ""
+	}
+	value, ok := stats.OfferPricePerSqm(offer)
+	if !ok || value > median*(1-cmd.BelowMedian.Ratio) {
+		return ""
+	}
+	percent := math.Round((1 - value/median) * 100)
+	return "🔥 " + strconv.FormatFloat(percent, 'f', 0, 64) + "% below region median of " +
+		strconv.FormatFloat(math.Round(median), 'f', 0, 64) + " per m²\n"
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/api"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/media"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/stats"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/umputun/go-flags"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStatsCommand_Execute(t *testing.T) {
+	eng := memory.NewEngine()
+	july := time.Date(2026, 7, 10, 0, 0, 0, 0, time.UTC)
+	august := time.Date(2026, 8, 10, 0, 0, 0, 0, time.UTC)
+	offerStore := store.NewOfferFileStore(eng)
+	require.NoError(t, offerStore.Save(store.Offer{Id: 1, RegionName: "Kraków", VendorSlug: "acme", PriceMin: 500000, AreaMin: 50, ImportedAt: july}))
+	require.NoError(t, offerStore.Save(store.Offer{Id: 2, RegionName: "Kraków", VendorSlug: "acme", PriceMin: 600000, AreaMin: 50, PriceHistory: []store.PriceRecord{
+		{At: july, PriceMin: 700000, AreaMin: 50},
+		{At: august, PriceMin: 600000, AreaMin: 50},
+	}}))
+	require.NoError(t, offerStore.Save(store.Offer{Id: 3, RegionName: "Wieliczka", VendorSlug: "foo", PriceMin: 800000, AreaMin: 100, ImportedAt: august}))
+	require.NoError(t, store.NewPrefixedOfferFileStore(eng, ProfilePrefix("krakow")).Save(store.Offer{Id: 4, RegionName: "Kraków", VendorSlug: "bar", PriceMin: 900000, AreaMin: 60, ImportedAt: august}))
+	require.NoError(t, store.NewPropertyFileStore(eng).Save(1, []store.Property{{Id: 1, Price: 500000}}))
+
+	cmd := StatsCommand{}
+	cmd.SetEngine(eng)
+	var out bytes.Buffer
+	cmd.out = &out
+	_, err := flags.NewParser(&cmd, flags.Default).ParseArgs(nil)
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, ""+
+		"REGION     OFFERS  MIN    P25    MEDIAN  P75    P90    MAX    CHANGE\n"+
+		"Kraków     2       10000  10500  11000   11500  11800  12000  -8.3%\n"+
+		"Wieliczka  1       8000   8000   8000    8000   8000   8000   +0.0%\n"+
+		"\n"+
+		"VENDOR  OFFERS  MIN    P25    MEDIAN  P75    P90    MAX    CHANGE\n"+
+		"acme    2       10000  10500  11000   11500  11800  12000  -8.3%\n"+
+		"foo     1       8000   8000   8000    8000   8000   8000   +0.0%\n"+
+		"\n"+
+		"REGION     MONTH    OFFERS  MEDIAN\n"+
+		"Kraków     2026-07  2       12000\n"+
+		"Kraków     2026-08  2       11000\n"+
+		"Wieliczka  2026-08  1       8000\n", out.String())
+
+	out.Reset()
+	_, err = flags.NewParser(&cmd, flags.Default).ParseArgs([]string{"--profile=krakow", "--format=json"})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	var report stats.Report
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	require.Len(t, report.Regions, 1)
+	assert.Equal(t, "Kraków", report.Regions[0].Name)
+	assert.Equal(t, 15000.0, report.Regions[0].Median)
+	require.Len(t, report.Vendors, 1)
+	assert.Equal(t, "bar", report.Vendors[0].Name)
+}
+
+func TestStatsCommand_Execute_Empty(t *testing.T) {
+	cmd := StatsCommand{Format: StatsFormatTable}
+	cmd.SetEngine(memory.NewEngine())
+	var out bytes.Buffer
+	cmd.out = &out
+
+	err := cmd.Execute(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "No offers with known price and area stored\n", out.String())
+}
+
+func TestStatsCommand_Execute_Corrupted(t *testing.T) {
+	eng := memory.NewEngine()
+	require.NoError(t, store.NewOfferFileStore(eng).Save(store.Offer{Id: 1, RegionName: "Kraków", PriceMin: 500000, AreaMin: 50}))
+	require.NoError(t, eng.Write("2.json", []byte(`{"id":2,`)))
+
+	cmd := StatsCommand{Format: StatsFormatJson}
+	cmd.SetEngine(eng)
+	var out bytes.Buffer
+	cmd.out = &out
+
+	err := cmd.Execute(nil)
+	require.NoError(t, err, "corrupted record is skipped")
+	var report stats.Report
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	require.Len(t, report.Regions, 1)
+	assert.Equal(t, 1, report.Regions[0].Count)
+}
+
+func TestOffersUpdatesCommand_Execute_BelowMedian(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/s/v2/offers/offer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "{\"results\":["+
+			"{\"id\":1,\"vendor\":{\"slug\":\"bar-sp-z-oo\"},\"name\":\"Wille Acme\",\"slug\":\"wille-acme-krakow-bronowice\","+
+			"	\"region\":{\"full_name\":\"małopolskie, Kraków, Bronowice\"},"+
+			"	\"stats\":{\"ranges_area_max\":180,\"ranges_area_min\":180,\"ranges_price_max\":1450000,\"ranges_price_min\":1450000}},"+
+			"{\"id\":2,\"vendor\":{\"slug\":\"property-foo-bar\"},\"name\":\"Foo Acme\",\"slug\":\"foo-acme-krakow-bronowice\","+
+			"	\"region\":{\"full_name\":\"małopolskie, Kraków, Bronowice\"},"+
+			"	\"stats\":{\"ranges_area_max\":50,\"ranges_area_min\":50,\"ranges_price_max\":600000,\"ranges_price_min\":600000}}],"+
+			"\"count\":2,\"page\":1,\"page_size\":2,\"next\":null,\"previous\":null}")
+	})
+
+	offerStore := store.NewOfferFileStore(memory.NewEngine())
+	for i, price := range []int64{500000, 600000, 700000} {
+		require.NoError(t, offerStore.Save(store.Offer{Id: int64(10 + i), RegionName: "małopolskie, Kraków, Bronowice", PriceMin: price, AreaMin: 50}))
+	}
+
+	notifier := MockWriter{}
+	cmd := OffersUpdatesCommand{}
+	cmd.SetCommon(CommonOpts{
+		PrimaryMarketAPI: api.NewHttpApi(server.URL),
+		PrimaryMarketURL: server.URL,
+		OfferStore:       offerStore,
+		OfferWriter:      &notifier,
+		Clock:            MockClock{},
+		ImageFetcher:     media.NewHttpFetcher(http.Client{}, 0),
+	})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{
+		"--request.regions=1",
+		"--below-median.ratio=0.15",
+		"--below-median.min-offers=3",
+	})
+	require.NoError(t, err)
+
+	err = cmd.Execute(nil)
+	require.NoError(t, err)
+
+	require.Len(t, notifier.called, 2)
+	assert.Equal(t, "🏡Wille Acme\n📍 małopolskie, Kraków, Bronowice\n📏 180-180\n🙀 1450000-1450000\n"+
+		"🔥 33% below region median of 12000 per m²\n"+
+		"\n➡️ "+server.URL+"/oferty/bar-sp-z-oo/wille-acme-krakow-bronowice-1", notifier.called[0].Text)
+	assert.Equal(t, "🏡Foo Acme\n📍 małopolskie, Kraków, Bronowice\n📏 50-50\n🙀 600000-600000\n"+
+		"\n➡️ "+server.URL+"/oferty/property-foo-bar/foo-acme-krakow-bronowice-2", notifier.called[1].Text)
+
+	stored, err := offerStore.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, []store.PriceRecord{{PriceMin: 1450000, PriceMax: 1450000, AreaMin: 180, AreaMax: 180}}, stored.PriceHistory)
+}
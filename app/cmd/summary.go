@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RunSummary collects statistics of a single offers updates run, counters are updated concurrently by pipeline stages
+type RunSummary struct {
+	RunId                string             `json:"run_id"`
+	Profile              string             `json:"profile,omitempty"`
+	StartedAt            time.Time          `json:"started_at"`
+	DurationSeconds      float64            `json:"duration_seconds"`
+	RegionsProcessed     int64              `json:"regions_processed"`
+	OffersFetched        int64              `json:"offers_fetched"`
+	New                  int64              `json:"new"`
+	Risen                int64              `json:"risen"`
+	Dropped              int64              `json:"dropped"`
+	ImageChanged         int64              `json:"image_changed"`
+	PropertyChanged      int64              `json:"property_changed"`
+	Unchanged            int64              `json:"unchanged"`
+	Seeded               int64              `json:"seeded"`
+	SkippedByFilter      int64              `json:"skipped_by_filter"`
+	SkippedNoCoordinates int64              `json:"skipped_without_coordinates"`
+	Quarantined          int64              `json:"quarantined"`
+	NotificationFailures int64              `json:"notification_failures"`
+	PersistFailures      int64              `json:"persist_failures"`
+	StageSeconds         map[string]float64 `json:"stage_duration_seconds"`
+
+	lock sync.Mutex
+}
+
+func newRunSummary(runId string, startedAt time.Time) *RunSummary {
+	return &RunSummary{RunId: runId, StartedAt: startedAt, StageSeconds: map[string]float64{}}
+}
+
+func (s *RunSummary) inc(counter *int64) {
+	atomic.AddInt64(counter, 1)
+}
+
+// stageFinished records stage duration, stages running in several goroutines keep the longest one
+func (s *RunSummary) stageFinished(stage string, started time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	seconds := time.Since(started).Seconds()
+	if seconds > s.StageSeconds[stage] {
+		s.StageSeconds[stage] = seconds
+	}
+}
+
+func (s *RunSummary) finish(finishedAt time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.DurationSeconds = finishedAt.Sub(s.StartedAt).Seconds()
+}
+
+// Text formats the summary as a human readable multi line text
+func (s *RunSummary) Text() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	title := fmt.Sprintf("📊 Run %s summary", s.RunId)
+	if s.Profile != "" {
+		title = fmt.Sprintf("📊 Run %s summary of profile %s", s.RunId, s.Profile)
+	}
+	lines := []string{
+		title,
+		fmt.Sprintf("regions processed: %d", atomic.LoadInt64(&s.RegionsProcessed)),
+		fmt.Sprintf("offers fetched: %d", atomic.LoadInt64(&s.OffersFetched)),
+		fmt.Sprintf("new: %d", atomic.LoadInt64(&s.New)),
+		fmt.Sprintf("risen: %d", atomic.LoadInt64(&s.Risen)),
+		fmt.Sprintf("dropped: %d", atomic.LoadInt64(&s.Dropped)),
+		fmt.Sprintf("image changed: %d", atomic.LoadInt64(&s.ImageChanged)),
+		fmt.Sprintf("property changed: %d", atomic.LoadInt64(&s.PropertyChanged)),
+		fmt.Sprintf("unchanged: %d", atomic.LoadInt64(&s.Unchanged)),
+		fmt.Sprintf("seeded: %d", atomic.LoadInt64(&s.Seeded)),
+		fmt.Sprintf("skipped by filter: %d", atomic.LoadInt64(&s.SkippedByFilter)),
+		fmt.Sprintf("skipped without coordinates: %d", atomic.LoadInt64(&s.SkippedNoCoordinates)),
+		fmt.Sprintf("quarantined: %d", atomic.LoadInt64(&s.Quarantined)),
+		fmt.Sprintf("notification failures: %d", atomic.LoadInt64(&s.NotificationFailures)),
+		fmt.Sprintf("persist failures: %d", atomic.LoadInt64(&s.PersistFailures)),
+		fmt.Sprintf("duration: %.3fs", s.DurationSeconds),
+	}
+
+	stages := make([]string, 0, len(s.StageSeconds))
+	for stage := range s.StageSeconds {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		lines = append(lines, fmt.Sprintf("  %s: %.3fs", stage, s.StageSeconds[stage]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WriteFile writes the summary as json to the file
+func (s *RunSummary) WriteFile(path string) error {
+	s.lock.Lock()
+	b, err := json.MarshalIndent(s, "", "  ")
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/filter"
+	"github.com/umputun/go-flags"
+	"go.uber.org/multierr"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"reflect"
+	"sort"
+)
+
+// profilesKey is the config key profiles are defined under, all other keys are options
+const profilesKey = "profiles"
+
+// regionsKey is the option of regions requested without profiles, profiles run their own regions
+const regionsKey = "offers-updates.request.regions"
+
+// Writer types a profile can send notifications with
+const (
+	WriterTelegram = "telegram"
+	WriterLog      = "log"
+)
+
+// Config is a parsed configuration file. Options mirror long flag names with namespaces as nested keys,
+// e.g. `telegram: {chat-id: 1}` sets --telegram.chat-id, command options are nested under the command name.
+type Config struct {
+	Path     string
+	Options  map[string][]string
+	Profiles []Profile
+}
+
+// Profile is a named set of regions, filters and writers. Regions are referenced by ids or names, names are
+// resolved to ids with the api.
+type Profile struct {
+	Name    string         `yaml:"-"`
+	Regions []string       `yaml:"regions"`
+	Filter  filter.Options `yaml:"filter"`
+	Writers []Writer       `yaml:"writers"`
+}
+
+// Writer is a notification destination of a profile
+type Writer struct {
+	Type   string `yaml:"type"`
+	ChatId int64  `yaml:"chat-id"`
+}
+
+// Load reads the configuration file
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]yaml.Node
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("can't parse %s: %w", path, err)
+	}
+
+	cfg := Config{Path: path, Options: map[string][]string{}}
+	for key, node := range raw {
+		node := node
+		if key == profilesKey {
+			if cfg.Profiles, err = decodeProfiles(&node); err != nil {
+				return nil, fmt.Errorf("can't parse %s profiles: %w", path, err)
+			}
+			continue
+		}
+		if err := flatten(key, &node, cfg.Options); err != nil {
+			return nil, fmt.Errorf("can't parse %s: %w", path, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// Path finds configuration file path in args or env without parsing other options
+func Path(args []string) string {
+	var opts struct {
+		Config string `long:"config" env:"CONFIG"`
+	}
+	p := flags.NewParser(&opts, flags.IgnoreUnknown)
+	_, _ = p.ParseArgs(args)
+	return opts.Config
+}
+
+// Apply makes options values defaults of the parser options, so flags and env variables take precedence over
+// the file. Fails on options the parser does not have.
+func (c *Config) Apply(p *flags.Parser) error {
+	options := map[string]*flags.Option{}
+	collectOptions(p.Command, "", options)
+
+	var err error
+	for _, key := range c.keys() {
+		values := c.Options[key]
+		option, ok := options[key]
+		if !ok {
+			err = multierr.Append(err, fmt.Errorf("unknown option %s", key))
+			continue
+		}
+		if len(values) > 1 && !acceptsValues(option) {
+			err = multierr.Append(err, fmt.Errorf("option %s accepts a single value", key))
+			continue
+		}
+		option.Default = values
+	}
+	return err
+}
+
+// acceptsValues reports whether the option is a list or a map, so it can be set multiple times
+func acceptsValues(option *flags.Option) bool {
+	kind := reflect.TypeOf(option.Value()).Kind()
+	return kind == reflect.Slice || kind == reflect.Map
+}
+
+// Validate checks profiles
+func (c *Config) Validate() error {
+	var err error
+	if len(c.Profiles) > 0 && len(c.Options[regionsKey]) > 0 {
+		err = multierr.Append(err, fmt.Errorf("%s can't be combined with profiles, set regions of profiles instead", regionsKey))
+	}
+	for _, p := range c.Profiles {
+		if len(p.Regions) == 0 {
+			err = multierr.Append(err, fmt.Errorf("profile %s: no regions", p.Name))
+		}
+		if fErr := p.Filter.Validate(); fErr != nil {
+			err = multierr.Append(err, fmt.Errorf("profile %s: %w", p.Name, fErr))
+		}
+		if len(p.Writers) == 0 {
+			err = multierr.Append(err, fmt.Errorf("profile %s: no writers", p.Name))
+		}
+		for i, w := range p.Writers {
+			switch w.Type {
+			case WriterTelegram:
+				if w.ChatId == 0 {
+					err = multierr.Append(err, fmt.Errorf("profile %s: writer %d: chat-id is required", p.Name, i))
+				}
+			case WriterLog:
+			default:
+				err = multierr.Append(err, fmt.Errorf("profile %s: writer %d: unknown type %q", p.Name, i, w.Type))
+			}
+		}
+	}
+	return err
+}
+
+func (c *Config) keys() []string {
+	keys := make([]string, 0, len(c.Options))
+	for k := range c.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// decodeProfiles decodes profiles strictly, so misspelled keys are reported. Profiles are sorted by name.
+func decodeProfiles(node *yaml.Node) ([]Profile, error) {
+	b, err := yaml.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+
+	var profiles map[string]Profile
+	if err := dec.Decode(&profiles); err != nil {
+		return nil, err
+	}
+
+	result := make([]Profile, 0, len(profiles))
+	for name, p := range profiles {
+		p.Name = name
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// flatten collects scalar and list values of the node under dot separated keys
+func flatten(key string, node *yaml.Node, options map[string][]string) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		options[key] = []string{node.Value}
+	case yaml.SequenceNode:
+		values := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("%s: only lists of values are supported", key)
+			}
+			values = append(values, item.Value)
+		}
+		options[key] = values
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := flatten(key+"."+node.Content[i].Value, node.Content[i+1], options); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unsupported value", key)
+	}
+	return nil
+}
+
+// collectOptions maps options of the command, its groups and subcommands by long names prefixed with command names
+func collectOptions(c *flags.Command, prefix string, options map[string]*flags.Option) {
+	var collectGroup func(g *flags.Group)
+	collectGroup = func(g *flags.Group) {
+		for _, o := range g.Options() {
+			if o.LongName != "" {
+				options[prefix+o.LongNameWithNamespace()] = o
+			}
+		}
+		for _, sg := range g.Groups() {
+			collectGroup(sg)
+		}
+	}
+	collectGroup(c.Group)
+
+	for _, sc := range c.Commands() {
+		collectOptions(sc, prefix+sc.Name+".", options)
+	}
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/filter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/umputun/go-flags"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testOpts struct {
+	Command struct {
+		Request struct {
+			Regions []int64 `long:"regions" env:"REQUEST_REGIONS" env-delim:","`
+		} `group:"request" namespace:"request" env-namespace:"REQUEST"`
+		Watch time.Duration `long:"watch" env:"WATCH"`
+	} `command:"offers-updates"`
+
+	Url      string `long:"url" env:"URL"`
+	Debug    bool   `long:"debug" env:"DEBUG"`
+	Telegram struct {
+		ChatId int64 `long:"chat-id" env:"CHAT_ID"`
+	} `group:"telegram" namespace:"telegram" env-namespace:"TELEGRAM"`
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load("testdata/config.yaml")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]string{
+		"url":                  {"https://rynekpierwotny.pl"},
+		"debug":                {"true"},
+		"telegram.chat-id":     {"100"},
+		"offers-updates.watch": {"10m"},
+	}, cfg.Options)
+	assert.Equal(t, []Profile{
+		{
+			Name:    "krakow-family",
+			Regions: []string{"52258", "Kraków"},
+			Filter:  filter.Options{PriceMax: 900000, AreaMin: 60},
+			Writers: []Writer{{Type: WriterTelegram, ChatId: -100}, {Type: WriterLog}},
+		},
+		{
+			Name:    "warsaw-investment",
+			Regions: []string{"3"},
+			Writers: []Writer{{Type: WriterLog}},
+		},
+	}, cfg.Profiles)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestConfig_Apply(t *testing.T) {
+	cfg := writeConfig(t, "url: https://rynekpierwotny.pl\ndebug: true\ntelegram:\n  chat-id: 100\n"+
+		"offers-updates:\n  request:\n    regions: [1, 2]\n  watch: 10m\n")
+	for _, env := range []string{"URL", "DEBUG", "TELEGRAM_CHAT_ID", "REQUEST_REGIONS", "WATCH"} {
+		env := env
+		require.NoError(t, os.Unsetenv(env))
+		defer func() { _ = os.Unsetenv(env) }()
+	}
+	require.NoError(t, os.Setenv("TELEGRAM_CHAT_ID", "200"))
+
+	var opts testOpts
+	p := flags.NewParser(&opts, flags.Default)
+	require.NoError(t, cfg.Apply(p))
+	_, err := p.ParseArgs([]string{"--url=http://localhost", "offers-updates"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "http://localhost", opts.Url, "flag overrides file")
+	assert.Equal(t, int64(200), opts.Telegram.ChatId, "env overrides file")
+	assert.True(t, opts.Debug)
+	assert.Equal(t, []int64{1, 2}, opts.Command.Request.Regions)
+	assert.Equal(t, 10*time.Minute, opts.Command.Watch)
+	_, set := os.LookupEnv("WATCH")
+	assert.False(t, set, "file values are not set as env variables")
+}
+
+func TestConfig_Apply_UnknownOption(t *testing.T) {
+	cfg := writeConfig(t, "url: http://localhost\ntelegram:\n  chat: 1\n")
+
+	var opts testOpts
+	err := cfg.Apply(flags.NewParser(&opts, flags.Default))
+	assert.EqualError(t, err, "unknown option telegram.chat")
+}
+
+func TestLoad_UnknownProfileField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("profiles:\n  a:\n    regionz: [1]\n"), 0600))
+
+	_, err := Load(path)
+	assert.Error(t, err)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := writeConfig(t, "profiles:\n"+
+		"  a:\n    regions: [1]\n    writers: [{type: telegram}]\n"+
+		"  b:\n    filter: {price-min: 2, price-max: 1}\n    writers: [{type: email}]\n")
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "profile a: writer 0: chat-id is required")
+	assert.Contains(t, err.Error(), "profile b: no regions")
+	assert.Contains(t, err.Error(), "profile b: price min 2 is greater than price max 1")
+	assert.Contains(t, err.Error(), "profile b: writer 0: unknown type \"email\"")
+}
+
+func TestConfig_Validate_RegionsWithProfiles(t *testing.T) {
+	cfg := writeConfig(t, "offers-updates:\n  request:\n    regions: [1]\n"+
+		"profiles:\n  a:\n    regions: [2]\n    writers: [{type: log}]\n")
+
+	err := cfg.Validate()
+	assert.EqualError(t, err, "offers-updates.request.regions can't be combined with profiles, set regions of profiles instead")
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "a.yaml", Path([]string{"--url=x", "offers-updates", "--config", "a.yaml", "--dry-run"}))
+	assert.Equal(t, "", Path([]string{"offers-updates"}))
+}
+
+func writeConfig(t *testing.T, content string) *Config {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	return cfg
+}
@@ -0,0 +1,264 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/stats"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	FormatCsv     = "csv"
+	FormatJsonl   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// Parquet types of columns
+const (
+	kindInt64  = "INT64"
+	kindDouble = "DOUBLE"
+	kindString = "STRING"
+	kindTime   = "TIMESTAMP"
+)
+
+// Writer writes offers as rows of the selected columns
+type Writer interface {
+	Write(offer store.Offer) error
+
+	// Close finishes the output, it doesn't close the underlying writer
+	Close() error
+}
+
+// column is an exported offer field, value returns nil when the field is unknown
+type column struct {
+	name  string
+	kind  string
+	value func(o store.Offer) interface{}
+}
+
+var columns = []column{
+	{"id", kindInt64, func(o store.Offer) interface{} { return o.Id }},
+	{"name", kindString, func(o store.Offer) interface{} { return o.Name }},
+	{"slug", kindString, func(o store.Offer) interface{} { return o.Slug }},
+	{"vendor_slug", kindString, func(o store.Offer) interface{} { return o.VendorSlug }},
+	{"link", kindString, func(o store.Offer) interface{} { return o.Link }},
+	{"region_name", kindString, func(o store.Offer) interface{} { return o.RegionName }},
+	{"neighbourhood", kindString, func(o store.Offer) interface{} { return o.Neighbourhood }},
+	{"imported_at", kindTime, func(o store.Offer) interface{} { return o.ImportedAt }},
+	{"price_min", kindInt64, func(o store.Offer) interface{} { return o.PriceMin }},
+	{"price_max", kindInt64, func(o store.Offer) interface{} { return o.PriceMax }},
+	{"area_min", kindInt64, func(o store.Offer) interface{} { return int64(o.AreaMin) }},
+	{"area_max", kindInt64, func(o store.Offer) interface{} { return int64(o.AreaMax) }},
+	{"price_per_sqm", kindDouble, func(o store.Offer) interface{} {
+		if v, ok := stats.OfferPricePerSqm(o); ok {
+			return v
+		}
+		return nil
+	}},
+	{"latitude", kindDouble, func(o store.Offer) interface{} { return optionalFloat(o.Latitude) }},
+	{"longitude", kindDouble, func(o store.Offer) interface{} { return optionalFloat(o.Longitude) }},
+	{"main_image_link", kindString, func(o store.Offer) interface{} { return o.MainImageLink }},
+	{"notification_ref", kindString, func(o store.Offer) interface{} { return o.NotificationRef }},
+	{"price_history", kindString, func(o store.Offer) interface{} {
+		if len(o.PriceHistory) == 0 {
+			return nil
+		}
+		return o.PriceHistory
+	}},
+}
+
+// ColumnNames returns names of all columns in the default order
+func ColumnNames() []string {
+	names := make([]string, 0, len(columns))
+	for _, c := range columns {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// NewWriter creates a writer of the format with the columns, all columns are written when none are selected
+func NewWriter(format string, out io.Writer, names []string) (Writer, error) {
+	selected, err := selectColumns(names)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatCsv:
+		return newCsvWriter(out, selected)
+	case FormatJsonl:
+		return &jsonlWriter{out: out, columns: selected}, nil
+	case FormatParquet:
+		return newParquetWriter(out, selected)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func selectColumns(names []string) ([]column, error) {
+	if len(names) == 0 {
+		return columns, nil
+	}
+	selected := make([]column, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, c := range columns {
+			if c.name == name {
+				selected = append(selected, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q, available columns are %s", name, strings.Join(ColumnNames(), ","))
+		}
+	}
+	return selected, nil
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []column
+}
+
+func newCsvWriter(out io.Writer, selected []column) (*csvWriter, error) {
+	w := csv.NewWriter(out)
+	header := make([]string, 0, len(selected))
+	for _, c := range selected {
+		header = append(header, c.name)
+	}
+	return &csvWriter{w: w, columns: selected}, w.Write(header)
+}
+
+func (c *csvWriter) Write(offer store.Offer) error {
+	record := make([]string, 0, len(c.columns))
+	for _, col := range c.columns {
+		s, err := formatValue(col.value(offer))
+		if err != nil {
+			return err
+		}
+		record = append(record, s)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlWriter writes an object per line keeping the order of columns, unknown values are null
+type jsonlWriter struct {
+	out     io.Writer
+	columns []column
+}
+
+func (j *jsonlWriter) Write(offer store.Offer) error {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, col := range j.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(col.name)
+		value, err := json.Marshal(col.value(offer))
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	_, err := j.out.Write(buf.Bytes())
+	return err
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+// parquetWriter writes optional columns of primitive types, timestamps are stored in milliseconds and price
+// history as a json string
+type parquetWriter struct {
+	w       *writer.CSVWriter
+	columns []column
+}
+
+func newParquetWriter(out io.Writer, selected []column) (*parquetWriter, error) {
+	md := make([]string, 0, len(selected))
+	for _, c := range selected {
+		var t string
+		switch c.kind {
+		case kindInt64:
+			t = "type=INT64"
+		case kindDouble:
+			t = "type=DOUBLE"
+		case kindTime:
+			t = "type=INT64, convertedtype=TIMESTAMP_MILLIS"
+		default:
+			t = "type=BYTE_ARRAY, convertedtype=UTF8"
+		}
+		md = append(md, "name="+c.name+", "+t+", repetitiontype=OPTIONAL")
+	}
+	w, err := writer.NewCSVWriterFromWriter(md, out, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetWriter{w: w, columns: selected}, nil
+}
+
+func (p *parquetWriter) Write(offer store.Offer) error {
+	record := make([]interface{}, 0, len(p.columns))
+	for _, col := range p.columns {
+		v := col.value(offer)
+		switch value := v.(type) {
+		case time.Time:
+			v = value.UnixNano() / int64(time.Millisecond)
+		case []store.PriceRecord:
+			b, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			v = string(b)
+		}
+		record = append(record, v)
+	}
+	return p.w.Write(record)
+}
+
+func (p *parquetWriter) Close() error {
+	return p.w.WriteStop()
+}
+
+func formatValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case time.Time:
+		return value.Format(time.RFC3339), nil
+	default:
+		b, err := json.Marshal(value)
+		return string(b), err
+	}
+}
+
+func optionalFloat(v float64) interface{} {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
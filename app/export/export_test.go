@@ -0,0 +1,85 @@
+package export
+
+import (
+	"bytes"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+	"testing"
+	"time"
+)
+
+var offers = []store.Offer{
+	{Id: 1, Name: "Wille Acme", RegionName: "małopolskie, Kraków, Bronowice", ImportedAt: time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC),
+		PriceMin: 500000, PriceMax: 1200000, AreaMin: 50, AreaMax: 100, Latitude: 50.08, Longitude: 19.89,
+		PriceHistory: []store.PriceRecord{{At: time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC), PriceMin: 500000, PriceMax: 1200000, AreaMin: 50, AreaMax: 100}}},
+	{Id: 2, Name: "Foo \"Acme\", Wieliczka", RegionName: "małopolskie, Wieliczka", ImportedAt: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+func TestNewWriter_Csv(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(FormatCsv, &out, []string{"id", "name", "imported_at", "price_per_sqm", "latitude", "price_history"})
+	require.NoError(t, err)
+	for _, o := range offers {
+		require.NoError(t, w.Write(o))
+	}
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, ""+
+		"id,name,imported_at,price_per_sqm,latitude,price_history\n"+
+		"1,Wille Acme,2026-08-10T12:00:00Z,11000,50.08,\"[{\"\"at\"\":\"\"2026-08-10T12:00:00Z\"\",\"\"price_min\"\":500000,\"\"price_max\"\":1200000,\"\"area_min\"\":50,\"\"area_max\"\":100}]\"\n"+
+		"2,\"Foo \"\"Acme\"\", Wieliczka\",2026-09-01T00:00:00Z,,,\n", out.String())
+}
+
+func TestNewWriter_Jsonl(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(FormatJsonl, &out, []string{"region_name", "id", "price_per_sqm"})
+	require.NoError(t, err)
+	for _, o := range offers {
+		require.NoError(t, w.Write(o))
+	}
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, ""+
+		"{\"region_name\":\"małopolskie, Kraków, Bronowice\",\"id\":1,\"price_per_sqm\":11000}\n"+
+		"{\"region_name\":\"małopolskie, Wieliczka\",\"id\":2,\"price_per_sqm\":null}\n", out.String())
+}
+
+func TestNewWriter_Parquet(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(FormatParquet, &out, []string{"id", "region_name", "imported_at", "price_per_sqm"})
+	require.NoError(t, err)
+	for _, o := range offers {
+		require.NoError(t, w.Write(o))
+	}
+	require.NoError(t, w.Close())
+
+	type row struct {
+		Id          *int64   `parquet:"name=id, type=INT64, repetitiontype=OPTIONAL"`
+		RegionName  *string  `parquet:"name=region_name, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+		ImportedAt  *int64   `parquet:"name=imported_at, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+		PricePerSqm *float64 `parquet:"name=price_per_sqm, type=DOUBLE, repetitiontype=OPTIONAL"`
+	}
+	pf, err := buffer.NewBufferFile(out.Bytes())
+	require.NoError(t, err)
+	pr, err := reader.NewParquetReader(pf, new(row), 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), pr.GetNumRows())
+	rows := make([]row, 2)
+	require.NoError(t, pr.Read(&rows))
+	pr.ReadStop()
+
+	assert.Equal(t, int64(1), *rows[0].Id)
+	assert.Equal(t, "małopolskie, Kraków, Bronowice", *rows[0].RegionName)
+	assert.Equal(t, offers[0].ImportedAt.UnixNano()/int64(time.Millisecond), *rows[0].ImportedAt)
+	assert.Equal(t, 11000.0, *rows[0].PricePerSqm)
+	assert.Equal(t, int64(2), *rows[1].Id)
+	assert.Nil(t, rows[1].PricePerSqm)
+}
+
+func TestNewWriter_UnknownColumn(t *testing.T) {
+	_, err := NewWriter(FormatCsv, &bytes.Buffer{}, []string{"id", "price"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,78 @@
+package filter
+
+import (
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+)
+
+// Options describes offers which are kept, zero values are not applied. Offers without known price or area
+// are kept since they can't be compared, offers without coordinates are skipped when points or neighbourhoods are set.
+type Options struct {
+	PriceMin int64   `long:"price-min" env:"PRICE_MIN" yaml:"price-min" description:"skip offers cheaper than the price"`
+	PriceMax int64   `long:"price-max" env:"PRICE_MAX" yaml:"price-max" description:"skip offers more expensive than the price"`
+	AreaMin  int     `long:"area-min" env:"AREA_MIN" yaml:"area-min" description:"skip offers with smaller properties only"`
+	AreaMax  int     `long:"area-max" env:"AREA_MAX" yaml:"area-max" description:"skip offers with bigger properties only"`
+	Near     []Point `long:"near" env:"NEAR" env-delim:";" yaml:"near" description:"keep offers within the radius of any point, format latitude,longitude,radius_km[,name]"`
+
+	Neighbourhoods Neighbourhoods `long:"neighbourhoods" env:"NEIGHBOURHOODS" yaml:"neighbourhoods" description:"GeoJSON file with polygons, keep offers inside any of them"`
+}
+
+// Validate checks whether ranges are correct
+func (o Options) Validate() error {
+	if o.PriceMin < 0 || o.PriceMax < 0 || o.AreaMin < 0 || o.AreaMax < 0 {
+		return fmt.Errorf("filter values can't be negative")
+	}
+	if o.PriceMax > 0 && o.PriceMin > o.PriceMax {
+		return fmt.Errorf("price min %d is greater than price max %d", o.PriceMin, o.PriceMax)
+	}
+	if o.AreaMax > 0 && o.AreaMin > o.AreaMax {
+		return fmt.Errorf("area min %d is greater than area max %d", o.AreaMin, o.AreaMax)
+	}
+	for _, p := range o.Near {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NeedsCoordinates reports whether offers are filtered by location, so offers without coordinates are skipped
+func (o Options) NeedsCoordinates() bool {
+	return len(o.Near) > 0 || len(o.Neighbourhoods.Polygons) > 0
+}
+
+// Accepts reports whether price and area ranges of the offer overlap with the configured ones and the offer is
+// within the radius of any point and inside any neighbourhood
+func (o Options) Accepts(offer store.Offer) bool {
+	if len(o.Near) > 0 && !withinAny(offer, o.Near) {
+		return false
+	}
+	if len(o.Neighbourhoods.Polygons) > 0 && o.Neighbourhoods.Match(offer) == "" {
+		return false
+	}
+	if offer.PriceMin > 0 || offer.PriceMax > 0 {
+		if !overlaps(offer.PriceMin, offer.PriceMax, o.PriceMin, o.PriceMax) {
+			return false
+		}
+	}
+	if offer.AreaMin > 0 || offer.AreaMax > 0 {
+		if !overlaps(int64(offer.AreaMin), int64(offer.AreaMax), int64(o.AreaMin), int64(o.AreaMax)) {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps reports whether [min, max] range overlaps with [from, to] range, zero from and to are unbounded
+func overlaps(min int64, max int64, from int64, to int64) bool {
+	if max == 0 {
+		max = min
+	}
+	if from > 0 && max < from {
+		return false
+	}
+	if to > 0 && min > to {
+		return false
+	}
+	return true
+}
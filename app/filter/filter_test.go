@@ -0,0 +1,37 @@
+package filter
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOptions_Accepts(t *testing.T) {
+	opts := Options{PriceMin: 500000, PriceMax: 900000, AreaMin: 60}
+
+	tbl := []struct {
+		offer    store.Offer
+		accepted bool
+	}{
+		{store.Offer{PriceMin: 450000, PriceMax: 950000, AreaMin: 40, AreaMax: 80}, true},
+		{store.Offer{PriceMin: 950000, PriceMax: 1150000, AreaMin: 60, AreaMax: 80}, false},
+		{store.Offer{PriceMin: 300000, PriceMax: 450000, AreaMin: 60, AreaMax: 80}, false},
+		{store.Offer{PriceMin: 600000, PriceMax: 700000, AreaMin: 30, AreaMax: 55}, false},
+		{store.Offer{PriceMin: 600000, AreaMin: 70}, true},
+		{store.Offer{AreaMin: 139, AreaMax: 373}, true},
+		{store.Offer{}, true},
+	}
+
+	for _, tt := range tbl {
+		assert.Equal(t, tt.accepted, opts.Accepts(tt.offer), "%+v", tt.offer)
+	}
+	assert.True(t, Options{}.Accepts(store.Offer{PriceMin: 1, PriceMax: 2}))
+}
+
+func TestOptions_Validate(t *testing.T) {
+	assert.NoError(t, Options{}.Validate())
+	assert.NoError(t, Options{PriceMin: 1, AreaMin: 60, AreaMax: 60}.Validate())
+	assert.Error(t, Options{PriceMin: 2, PriceMax: 1}.Validate())
+	assert.Error(t, Options{AreaMin: 2, AreaMax: 1}.Validate())
+	assert.Error(t, Options{AreaMin: -1}.Validate())
+}
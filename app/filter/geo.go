@@ -0,0 +1,124 @@
+package filter
+
+import (
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"gopkg.in/yaml.v3"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// earthRadiusKm is the mean Earth radius used by haversine formula
+const earthRadiusKm = 6371.0
+
+// Point is a location offers are kept within the radius of
+type Point struct {
+	Name      string  `yaml:"name"`
+	Latitude  float64 `yaml:"latitude"`
+	Longitude float64 `yaml:"longitude"`
+	RadiusKm  float64 `yaml:"radius-km"`
+}
+
+// Distance is a distance of an offer to the point
+type Distance struct {
+	Name string
+	Km   float64
+}
+
+// UnmarshalFlag parses the point in format latitude,longitude,radius_km[,name]
+func (p *Point) UnmarshalFlag(value string) error {
+	parts := strings.SplitN(value, ",", 4)
+	if len(parts) < 3 {
+		return fmt.Errorf("point %q has to be in format latitude,longitude,radius_km[,name]", value)
+	}
+
+	var err error
+	if p.Latitude, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64); err != nil {
+		return fmt.Errorf("point %q: invalid latitude: %w", value, err)
+	}
+	if p.Longitude, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64); err != nil {
+		return fmt.Errorf("point %q: invalid longitude: %w", value, err)
+	}
+	if p.RadiusKm, err = strconv.ParseFloat(strings.TrimSpace(parts[2]), 64); err != nil {
+		return fmt.Errorf("point %q: invalid radius: %w", value, err)
+	}
+	if len(parts) == 4 {
+		p.Name = strings.TrimSpace(parts[3])
+	}
+	return nil
+}
+
+// UnmarshalYAML accepts the point as a mapping or as a string in the flag format
+func (p *Point) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return p.UnmarshalFlag(node.Value)
+	}
+	type plain Point
+	return node.Decode((*plain)(p))
+}
+
+// Validate checks coordinates and radius
+func (p Point) Validate() error {
+	if p.Latitude < -90 || p.Latitude > 90 || p.Longitude < -180 || p.Longitude > 180 {
+		return fmt.Errorf("point %s has invalid coordinates %v,%v", p.label(), p.Latitude, p.Longitude)
+	}
+	if p.RadiusKm <= 0 {
+		return fmt.Errorf("point %s radius has to be positive", p.label())
+	}
+	return nil
+}
+
+// label names the point by its name or coordinates
+func (p Point) label() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return strconv.FormatFloat(p.Latitude, 'f', -1, 64) + "," + strconv.FormatFloat(p.Longitude, 'f', -1, 64)
+}
+
+// Distances calculates distances of the offer to every point, returns nil when offer coordinates are unknown
+func Distances(offer store.Offer, points []Point) []Distance {
+	lat, lon, ok := offer.Coordinates()
+	if !ok {
+		return nil
+	}
+	distances := make([]Distance, 0, len(points))
+	for _, p := range points {
+		distances = append(distances, Distance{Name: p.label(), Km: haversineKm(lat, lon, p.Latitude, p.Longitude)})
+	}
+	return distances
+}
+
+// withinAny reports whether the offer is within the radius of any point, offers without coordinates are not
+func withinAny(offer store.Offer, points []Point) bool {
+	lat, lon, ok := offer.Coordinates()
+	if !ok {
+		return false
+	}
+	for _, p := range points {
+		if haversineKm(lat, lon, p.Latitude, p.Longitude) <= p.RadiusKm {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCoordinates reports whether coordinates of the offer listing or details are known
+func HasCoordinates(offer store.Offer) bool {
+	_, _, ok := offer.Coordinates()
+	return ok
+}
+
+// haversineKm calculates great-circle distance between two points
+func haversineKm(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	dLat := radians(lat2 - lat1)
+	dLon := radians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
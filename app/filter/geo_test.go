@@ -0,0 +1,77 @@
+package filter
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+func TestHaversineKm(t *testing.T) {
+	// Kraków main square to Warsaw palace of culture
+	assert.InDelta(t, 252.0, haversineKm(50.0614, 19.9366, 52.2318, 21.0060), 1)
+	assert.Equal(t, 0.0, haversineKm(50.0614, 19.9366, 50.0614, 19.9366))
+}
+
+func TestPoint_UnmarshalFlag(t *testing.T) {
+	var p Point
+	require.NoError(t, p.UnmarshalFlag("50.0614, 19.9366, 2.5, Rynek Główny"))
+	assert.Equal(t, Point{Name: "Rynek Główny", Latitude: 50.0614, Longitude: 19.9366, RadiusKm: 2.5}, p)
+
+	p = Point{}
+	require.NoError(t, p.UnmarshalFlag("50.0614,19.9366,2"))
+	assert.Equal(t, Point{Latitude: 50.0614, Longitude: 19.9366, RadiusKm: 2}, p)
+
+	assert.Error(t, p.UnmarshalFlag("50.0614,19.9366"))
+	assert.Error(t, p.UnmarshalFlag("north,19.9366,2"))
+}
+
+func TestPoint_UnmarshalYAML(t *testing.T) {
+	var opts Options
+	err := yaml.Unmarshal([]byte("near:\n"+
+		"  - 50.0614,19.9366,2,Rynek\n"+
+		"  - name: office\n"+
+		"    latitude: 50.09\n"+
+		"    longitude: 19.98\n"+
+		"    radius-km: 1.5\n"), &opts)
+	require.NoError(t, err)
+	assert.Equal(t, []Point{
+		{Name: "Rynek", Latitude: 50.0614, Longitude: 19.9366, RadiusKm: 2},
+		{Name: "office", Latitude: 50.09, Longitude: 19.98, RadiusKm: 1.5},
+	}, opts.Near)
+}
+
+func TestPoint_Validate(t *testing.T) {
+	assert.NoError(t, Point{Latitude: 50.06, Longitude: 19.93, RadiusKm: 1}.Validate())
+	assert.Error(t, Point{Latitude: 91, Longitude: 19.93, RadiusKm: 1}.Validate())
+	assert.Error(t, Point{Latitude: 50.06, Longitude: 181, RadiusKm: 1}.Validate())
+	assert.Error(t, Point{Latitude: 50.06, Longitude: 19.93}.Validate())
+	assert.Error(t, Options{Near: []Point{{Latitude: 50.06, Longitude: 19.93}}}.Validate())
+}
+
+func TestOptions_Accepts_Near(t *testing.T) {
+	opts := Options{Near: []Point{
+		{Name: "Rynek", Latitude: 50.0614, Longitude: 19.9366, RadiusKm: 5},
+		{Name: "Tarnów", Latitude: 50.0121, Longitude: 20.9858, RadiusKm: 3},
+	}}
+
+	assert.True(t, opts.Accepts(store.Offer{Latitude: 50.08, Longitude: 19.89}))
+	assert.True(t, opts.Accepts(store.Offer{Latitude: 50.01, Longitude: 20.99}))
+	assert.False(t, opts.Accepts(store.Offer{Latitude: 49.98, Longitude: 20.06}))
+	assert.False(t, opts.Accepts(store.Offer{}))
+	assert.True(t, opts.Accepts(store.Offer{Details: &store.OfferDetails{Latitude: 50.08, Longitude: 19.89}}),
+		"coordinates of details are used when the listing has none")
+}
+
+func TestDistances(t *testing.T) {
+	points := []Point{{Name: "Rynek", Latitude: 50.0614, Longitude: 19.9366, RadiusKm: 5}, {Latitude: 50.0121, Longitude: 20.9858, RadiusKm: 3}}
+
+	distances := Distances(store.Offer{Latitude: 50.08, Longitude: 19.89}, points)
+	require.Len(t, distances, 2)
+	assert.Equal(t, "Rynek", distances[0].Name)
+	assert.InDelta(t, 3.9, distances[0].Km, 0.5)
+	assert.Equal(t, "50.0121,20.9858", distances[1].Name)
+
+	assert.Nil(t, Distances(store.Offer{}, points))
+}
@@ -0,0 +1,183 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"strconv"
+)
+
+// Neighbourhoods are named polygons loaded from a GeoJSON file, offers are kept when they are inside any of them
+type Neighbourhoods struct {
+	Path     string
+	Polygons []Polygon
+}
+
+// Polygon is a named area made of rings of [longitude, latitude] positions. The first ring of every part is
+// the boundary, the following ones are holes.
+type Polygon struct {
+	Name  string
+	Parts [][][][2]float64
+}
+
+type geoJson struct {
+	Type       string          `json:"type"`
+	Features   []geoJson       `json:"features"`
+	Geometry   *geoJson        `json:"geometry"`
+	Properties json.RawMessage `json:"properties"`
+	Id         interface{}     `json:"id"`
+
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// UnmarshalFlag loads polygons from the GeoJSON file at the path
+func (n *Neighbourhoods) UnmarshalFlag(path string) error {
+	loaded, err := LoadNeighbourhoods(path)
+	if err != nil {
+		return err
+	}
+	*n = loaded
+	return nil
+}
+
+// MarshalFlag returns the path polygons were loaded from
+func (n Neighbourhoods) MarshalFlag() (string, error) {
+	return n.Path, nil
+}
+
+// UnmarshalYAML loads polygons from the GeoJSON file at the path the node holds
+func (n *Neighbourhoods) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: neighbourhoods has to be a path to a GeoJSON file", node.Line)
+	}
+	return n.UnmarshalFlag(node.Value)
+}
+
+// LoadNeighbourhoods reads polygons of a GeoJSON file, it accepts a feature collection, a feature or a bare
+// Polygon or MultiPolygon geometry. Features are named by "name" property, by id or by their position.
+func LoadNeighbourhoods(path string) (Neighbourhoods, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Neighbourhoods{}, err
+	}
+
+	var doc geoJson
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return Neighbourhoods{}, fmt.Errorf("can't parse %s: %w", path, err)
+	}
+
+	features := []geoJson{doc}
+	if doc.Type == "FeatureCollection" {
+		features = doc.Features
+	}
+
+	n := Neighbourhoods{Path: path}
+	for i, f := range features {
+		polygon, err := parseFeature(f, i)
+		if err != nil {
+			return Neighbourhoods{}, fmt.Errorf("can't parse %s feature %d: %w", path, i, err)
+		}
+		if polygon != nil {
+			n.Polygons = append(n.Polygons, *polygon)
+		}
+	}
+	if len(n.Polygons) == 0 {
+		return Neighbourhoods{}, fmt.Errorf("%s has no polygons", path)
+	}
+	return n, nil
+}
+
+// Match returns name of the first polygon the offer is inside, empty when the offer is outside of all polygons
+// or its coordinates are unknown
+func (n Neighbourhoods) Match(offer store.Offer) string {
+	lat, lon, ok := offer.Coordinates()
+	if !ok {
+		return ""
+	}
+	for _, p := range n.Polygons {
+		if p.Contains(lon, lat) {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+// Contains reports whether the position is inside the polygon boundary and outside of its holes
+func (p Polygon) Contains(lon float64, lat float64) bool {
+	for _, rings := range p.Parts {
+		if len(rings) == 0 || !ringContains(rings[0], lon, lat) {
+			continue
+		}
+		inHole := false
+		for _, hole := range rings[1:] {
+			if ringContains(hole, lon, lat) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFeature reads a polygon of the feature, returns nil for features of other geometry types
+func parseFeature(f geoJson, index int) (*Polygon, error) {
+	geometry := &f
+	if f.Type == "Feature" {
+		geometry = f.Geometry
+		if geometry == nil {
+			return nil, nil
+		}
+	}
+
+	polygon := Polygon{Name: featureName(f, index)}
+	switch geometry.Type {
+	case "Polygon":
+		var rings [][][2]float64
+		if err := json.Unmarshal(geometry.Coordinates, &rings); err != nil {
+			return nil, err
+		}
+		polygon.Parts = [][][][2]float64{rings}
+	case "MultiPolygon":
+		if err := json.Unmarshal(geometry.Coordinates, &polygon.Parts); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+	return &polygon, nil
+}
+
+func featureName(f geoJson, index int) string {
+	var properties struct {
+		Name string `json:"name"`
+	}
+	if len(f.Properties) > 0 {
+		_ = json.Unmarshal(f.Properties, &properties)
+	}
+	switch {
+	case properties.Name != "":
+		return properties.Name
+	case f.Id != nil:
+		return fmt.Sprint(f.Id)
+	default:
+		return "area " + strconv.Itoa(index+1)
+	}
+}
+
+// ringContains checks whether the position is inside the ring with ray casting
+func ringContains(ring [][2]float64, lon float64, lat float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,69 @@
+package filter
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadNeighbourhoods(t *testing.T) {
+	n, err := LoadNeighbourhoods("testdata/neighbourhoods.geojson")
+	require.NoError(t, err)
+	require.Len(t, n.Polygons, 2)
+	assert.Equal(t, "Bronowice", n.Polygons[0].Name)
+	assert.Equal(t, "podgorze", n.Polygons[1].Name)
+	assert.Len(t, n.Polygons[1].Parts, 2)
+
+	_, err = LoadNeighbourhoods("testdata/missing.geojson")
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	points := filepath.Join(dir, "points.geojson")
+	require.NoError(t, ioutil.WriteFile(points, []byte(`{"type":"Point","coordinates":[19.93,50.06]}`), 0600))
+	_, err = LoadNeighbourhoods(points)
+	assert.EqualError(t, err, points+" has no polygons")
+
+	polygon := filepath.Join(dir, "polygon.geojson")
+	require.NoError(t, ioutil.WriteFile(polygon, []byte(`{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`), 0600))
+	n, err = LoadNeighbourhoods(polygon)
+	require.NoError(t, err)
+	assert.Equal(t, "area 1", n.Polygons[0].Name)
+}
+
+func TestNeighbourhoods_Match(t *testing.T) {
+	n, err := LoadNeighbourhoods("testdata/neighbourhoods.geojson")
+	require.NoError(t, err)
+
+	tbl := []struct {
+		offer store.Offer
+		name  string
+	}{
+		{store.Offer{Latitude: 50.08, Longitude: 19.89}, "Bronowice"},
+		{store.Offer{Latitude: 50.075, Longitude: 19.865}, ""},
+		{store.Offer{Latitude: 50.04, Longitude: 19.96}, "podgorze"},
+		{store.Offer{Latitude: 50.01, Longitude: 20.01}, "podgorze"},
+		{store.Offer{Latitude: 50.0614, Longitude: 19.9366}, ""},
+		{store.Offer{}, ""},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.name, n.Match(tt.offer), "%+v", tt.offer)
+	}
+
+	opts := Options{Neighbourhoods: n}
+	assert.True(t, opts.Accepts(store.Offer{Latitude: 50.08, Longitude: 19.89}))
+	assert.False(t, opts.Accepts(store.Offer{Latitude: 50.0614, Longitude: 19.9366}))
+	assert.False(t, opts.Accepts(store.Offer{}))
+}
+
+func TestNeighbourhoods_UnmarshalYAML(t *testing.T) {
+	var opts Options
+	require.NoError(t, yaml.Unmarshal([]byte("neighbourhoods: testdata/neighbourhoods.geojson\n"), &opts))
+	assert.Equal(t, "testdata/neighbourhoods.geojson", opts.Neighbourhoods.Path)
+	assert.Len(t, opts.Neighbourhoods.Polygons, 2)
+
+	assert.Error(t, yaml.Unmarshal([]byte("neighbourhoods: [a, b]\n"), &opts))
+}
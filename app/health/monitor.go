@@ -0,0 +1,116 @@
+package health
+
+import (
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/util"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Monitor tracks application readiness and results of the runs to report whether the process is healthy
+type Monitor struct {
+	lock sync.Mutex
+
+	clock util.Clock
+	// interval is an expected interval between runs, 0 means runs are not periodic
+	interval time.Duration
+	// maxMissedRuns is an amount of intervals the process may not finish any run for
+	maxMissedRuns int
+	// errorBudget is an amount of consecutive failed runs after which the process is unhealthy
+	errorBudget int
+
+	ready        bool
+	startedAt    time.Time
+	lastFinished time.Time
+	failedRuns   int
+}
+
+func NewMonitor(clock util.Clock, interval time.Duration, maxMissedRuns int, errorBudget int) *Monitor {
+	return &Monitor{
+		clock:         clock,
+		interval:      interval,
+		maxMissedRuns: maxMissedRuns,
+		errorBudget:   errorBudget,
+		startedAt:     clock.Now(),
+	}
+}
+
+// SetReady marks the process as ready after all its dependencies are initialized
+func (m *Monitor) SetReady() {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.ready = true
+}
+
+// RunFinished records result of the finished run
+func (m *Monitor) RunFinished(err error) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.lastFinished = m.clock.Now()
+	if err != nil {
+		m.failedRuns++
+		return
+	}
+	m.failedRuns = 0
+}
+
+func (m *Monitor) Ready() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.ready {
+		return fmt.Errorf("not initialized yet")
+	}
+	return nil
+}
+
+func (m *Monitor) Healthy() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.errorBudget > 0 && m.failedRuns >= m.errorBudget {
+		return fmt.Errorf("%d consecutive runs failed", m.failedRuns)
+	}
+	if m.interval <= 0 || m.maxMissedRuns <= 0 {
+		return nil
+	}
+
+	deadline := time.Duration(m.maxMissedRuns) * m.interval
+	since := m.lastFinished
+	if since.IsZero() {
+		since = m.startedAt
+	}
+	if elapsed := m.clock.Now().Sub(since); elapsed > deadline {
+		return fmt.Errorf("no run finished for %v", elapsed)
+	}
+	return nil
+}
+
+// ReadyHandler responds with 503 until the process is ready
+func (m *Monitor) ReadyHandler() http.Handler {
+	return checkHandler(m.Ready)
+}
+
+// HealthHandler responds with 503 when the process is unhealthy
+func (m *Monitor) HealthHandler() http.Handler {
+	return checkHandler(m.Healthy)
+}
+
+func checkHandler(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprint(w, "ok")
+	})
+}
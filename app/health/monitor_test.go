@@ -0,0 +1,62 @@
+package health
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMonitor_ReadyHandler(t *testing.T) {
+	m := NewMonitor(&mockClock{}, time.Minute, 3, 3)
+
+	assert.Equal(t, http.StatusServiceUnavailable, serve(m.ReadyHandler()))
+	m.SetReady()
+	assert.Equal(t, http.StatusOK, serve(m.ReadyHandler()))
+}
+
+func TestMonitor_Healthy_MissedRuns(t *testing.T) {
+	clock := &mockClock{time: time.Date(2021, 11, 20, 12, 0, 0, 0, time.UTC)}
+	m := NewMonitor(clock, time.Minute, 3, 3)
+
+	clock.time = clock.time.Add(2 * time.Minute)
+	assert.NoError(t, m.Healthy())
+
+	m.RunFinished(nil)
+	clock.time = clock.time.Add(3 * time.Minute)
+	assert.NoError(t, m.Healthy())
+
+	clock.time = clock.time.Add(time.Second)
+	assert.Error(t, m.Healthy())
+	assert.Equal(t, http.StatusServiceUnavailable, serve(m.HealthHandler()))
+}
+
+func TestMonitor_Healthy_ErrorBudget(t *testing.T) {
+	m := NewMonitor(&mockClock{}, 0, 3, 2)
+
+	m.RunFinished(errors.New("api is down"))
+	assert.NoError(t, m.Healthy())
+
+	m.RunFinished(errors.New("api is down"))
+	assert.Error(t, m.Healthy())
+
+	m.RunFinished(nil)
+	assert.NoError(t, m.Healthy())
+	assert.Equal(t, http.StatusOK, serve(m.HealthHandler()))
+}
+
+func serve(h http.Handler) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	return rec.Code
+}
+
+type mockClock struct {
+	time time.Time
+}
+
+func (m *mockClock) Now() time.Time {
+	return m.time
+}
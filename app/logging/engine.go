@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"errors"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"time"
+)
+
+// Engine logs all operations of the underlying engine with their duration and result
+type Engine struct {
+	engine  engine.Engine
+	backend string
+}
+
+func NewEngine(engine engine.Engine, backend string) engine.Engine {
+	return &Engine{engine: engine, backend: backend}
+}
+
+func (e *Engine) Read(path string) ([]byte, error) {
+	started := time.Now()
+	b, err := e.engine.Read(path)
+	e.log("read", path, started, err)
+	return b, err
+}
+
+func (e *Engine) Write(path string, bytes []byte) error {
+	started := time.Now()
+	err := e.engine.Write(path, bytes)
+	e.log("write", path, started, err)
+	return err
+}
+
+func (e *Engine) Exists(path string) (bool, error) {
+	started := time.Now()
+	exists, err := e.engine.Exists(path)
+	e.log("exists", path, started, err)
+	return exists, err
+}
+
+func (e *Engine) List(prefix string) ([]string, error) {
+	started := time.Now()
+	paths, err := e.engine.List(prefix)
+	e.log("list", prefix, started, err)
+	return paths, err
+}
+
+func (e *Engine) Delete(path string) error {
+	started := time.Now()
+	err := e.engine.Delete(path)
+	e.log("delete", path, started, err)
+	return err
+}
+
+func (e *Engine) log(operation string, path string, started time.Time, err error) {
+	logger := With(Fields{"stage": "engine", "engine": e.backend, "path": path, "duration": time.Since(started)})
+	// missing record is an expected outcome of read
+	if err != nil && !errors.Is(err, engine.ErrNotFound) {
+		logger.With(Fields{"error": err}).Printf("[WARN] Engine %v failed", operation)
+		return
+	}
+	logger.Printf("[DEBUG] Engine %v finished", operation)
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestEngine(t *testing.T) {
+	var buf bytes.Buffer
+	SetupOut(FormatJson, false, &buf)
+	defer Setup(FormatText, false)
+
+	eng := NewEngine(failingEngine{}, "test")
+	_, err := eng.Read("1.json")
+	assert.True(t, errors.Is(err, engine.ErrNotFound))
+	assert.EqualError(t, eng.Write("1.json", []byte("{}")), "disk is full")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1, "missing record is not a failure")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "warn", record["level"])
+	assert.Equal(t, "Engine write failed", record["msg"])
+	assert.Equal(t, "test", record["engine"])
+	assert.Equal(t, "1.json", record["path"])
+	assert.Equal(t, "disk is full", record["error"])
+}
+
+type failingEngine struct{}
+
+func (e failingEngine) Read(path string) ([]byte, error) {
+	return make([]byte, 0), engine.NotFound(path)
+}
+
+func (e failingEngine) Write(_ string, _ []byte) error {
+	return errors.New("disk is full")
+}
+
+func (e failingEngine) Exists(_ string) (bool, error) {
+	return false, nil
+}
+
+func (e failingEngine) List(_ string) ([]string, error) {
+	return nil, nil
+}
+
+func (e failingEngine) Delete(_ string) error {
+	return nil
+}
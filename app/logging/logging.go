@@ -0,0 +1,200 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/go-pkgz/lgr"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FormatText = "text"
+	FormatJson = "json"
+)
+
+// Fields are structured attributes attached to a log record
+type Fields map[string]interface{}
+
+var (
+	lock sync.RWMutex
+	// text logs records with fields appended to the message, callers are reported one frame above
+	text log.L = log.New(log.CallerDepth(1))
+	// jsonOut is set when records are written as json lines
+	jsonOut *jsonWriter
+	runId   string
+)
+
+// Setup configures both this package and the default lgr logger, in json format every lgr record is written as
+// a json line as well
+func Setup(format string, dbg bool) {
+	SetupOut(format, dbg, os.Stdout)
+}
+
+// SetupOut configures logging as Setup does with records written to out, e.g. to stderr when stdout receives data
+func SetupOut(format string, dbg bool, out io.Writer) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if format == FormatJson {
+		jsonOut = &jsonWriter{out: out, dbg: dbg}
+		log.Setup(log.Out(jsonOut), log.Err(jsonOut), log.Format("{{.Level}} {{.Message}}"), debugOption(dbg))
+		return
+	}
+
+	jsonOut = nil
+	if dbg {
+		log.Setup(log.Out(out), log.Debug, log.CallerFile, log.CallerFunc, log.Msec, log.LevelBraces)
+		text = log.New(log.Out(out), log.Debug, log.CallerFile, log.CallerFunc, log.Msec, log.LevelBraces, log.CallerDepth(1))
+		return
+	}
+	log.Setup(log.Out(out), log.Msec, log.LevelBraces)
+	text = log.New(log.Out(out), log.Msec, log.LevelBraces, log.CallerDepth(1))
+}
+
+// StartRun generates a new run correlation id attached to all following records
+func StartRun() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	lock.Lock()
+	defer lock.Unlock()
+	runId = id
+	return id
+}
+
+// Logger logs records with attached fields
+type Logger struct {
+	fields Fields
+}
+
+func With(fields Fields) Logger {
+	return Logger{fields: fields}
+}
+
+// With returns a logger with fields merged into already attached ones
+func (l Logger) With(fields Fields) Logger {
+	merged := Fields{}
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return Logger{fields: merged}
+}
+
+// Printf logs the message, format may start with a level prefix like [DEBUG] as lgr does
+func (l Logger) Printf(format string, args ...interface{}) {
+	lock.RLock()
+	out, current, txt := jsonOut, runId, text
+	lock.RUnlock()
+
+	fields := l.fields
+	if current != "" {
+		fields = l.With(Fields{"run_id": current}).fields
+	}
+
+	if out != nil {
+		level, msg := splitLevel(fmt.Sprintf(format, args...))
+		out.write(level, msg, fields)
+		return
+	}
+	txt.Logf(format+"%s", append(args, formatFields(fields))...)
+}
+
+func debugOption(dbg bool) log.Option {
+	if dbg {
+		return log.Debug
+	}
+	return func(*log.Logger) {}
+}
+
+// formatFields formats fields as sorted key=value pairs appended to text records
+func formatFields(fields Fields) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, fields[k]))
+	}
+	return " [" + strings.Join(pairs, " ") + "]"
+}
+
+func splitLevel(line string) (string, string) {
+	for _, lv := range []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR", "PANIC", "FATAL"} {
+		if strings.HasPrefix(line, "["+lv+"]") {
+			return lv, strings.TrimSpace(line[len(lv)+2:])
+		}
+		if strings.HasPrefix(line, lv) {
+			return lv, strings.TrimSpace(line[len(lv):])
+		}
+	}
+	return "INFO", line
+}
+
+// jsonWriter writes records as json lines, it also receives records formatted by lgr as "LEVEL message"
+type jsonWriter struct {
+	lock sync.Mutex
+	out  io.Writer
+	dbg  bool
+}
+
+func (w *jsonWriter) Write(p []byte) (int, error) {
+	level, msg := splitLevel(strings.TrimSuffix(string(p), "\n"))
+
+	lock.RLock()
+	current := runId
+	lock.RUnlock()
+
+	fields := Fields{}
+	if current != "" {
+		fields["run_id"] = current
+	}
+	w.write(level, msg, fields)
+	return len(p), nil
+}
+
+func (w *jsonWriter) write(level string, msg string, fields Fields) {
+	if (level == "DEBUG" || level == "TRACE") && !w.dbg {
+		return
+	}
+
+	record := make(map[string]interface{}, len(fields)+3)
+	for k, v := range fields {
+		switch val := v.(type) {
+		case error:
+			record[k] = val.Error()
+		case time.Duration:
+			record[k] = val.String()
+		default:
+			record[k] = val
+		}
+	}
+	record["time"] = time.Now().Format(time.RFC3339Nano)
+	record["level"] = strings.ToLower(level)
+	record["msg"] = msg
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"level": "error", "msg": fmt.Sprintf("can't marshal log record: %v", err)})
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, _ = w.out.Write(append(b, '\n'))
+}
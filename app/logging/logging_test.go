@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	log "github.com/go-pkgz/lgr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger_Printf_Json(t *testing.T) {
+	var buf bytes.Buffer
+	SetupOut(FormatJson, false, &buf)
+	defer Setup(FormatText, false)
+	id := StartRun()
+
+	With(Fields{"stage": "persist", "offer_id": 1}).
+		With(Fields{"duration": 15 * time.Millisecond, "error": errors.New("access denied")}).
+		Printf("[WARN] Can't persist store offer for id %v", 1)
+	With(Fields{"stage": "persist"}).Printf("[DEBUG] Persisting orders..")
+	log.Printf("[INFO] Notifying message with title %v", "yay")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "warn", record["level"])
+	assert.Equal(t, "Can't persist store offer for id 1", record["msg"])
+	assert.Equal(t, id, record["run_id"])
+	assert.Equal(t, "persist", record["stage"])
+	assert.Equal(t, float64(1), record["offer_id"])
+	assert.Equal(t, "15ms", record["duration"])
+	assert.Equal(t, "access denied", record["error"])
+
+	record = map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, "info", record["level"])
+	assert.Equal(t, "Notifying message with title yay", record["msg"])
+	assert.Equal(t, id, record["run_id"])
+}
+
+func TestLogger_Printf_TextOut(t *testing.T) {
+	var buf bytes.Buffer
+	SetupOut(FormatText, false, &buf)
+	defer Setup(FormatText, false)
+
+	With(Fields{"stage": "export"}).Printf("[INFO] Exported %d offers", 2)
+	log.Printf("[INFO] Notifying message with title %v", "yay")
+
+	assert.Contains(t, buf.String(), "Exported 2 offers")
+	assert.Contains(t, buf.String(), "Notifying message with title yay")
+}
+
+func TestFormatFields(t *testing.T) {
+	assert.Equal(t, " [offer_id=1 stage=map]", formatFields(Fields{"stage": "map", "offer_id": 1}))
+	assert.Equal(t, "", formatFields(Fields{}))
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	as3 "github.com/aws/aws-sdk-go/service/s3"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/api"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/cmd"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/config"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/health"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/media"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/metrics"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/compression"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/encryption"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/file"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/memory"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/mock"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/registry"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/s3"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/util"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/writer"
@@ -20,20 +29,44 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"runtime"
 	"syscall"
+	"time"
 )
 
 type Opts struct {
 	OffersUpdates cmd.OffersUpdatesCommand `command:"offers-updates"`
+	Config        cmd.ConfigCommand        `command:"config" description:"configuration file commands"`
+	Regions       cmd.RegionsCommand       `command:"regions" description:"region commands"`
+	Stats         cmd.StatsCommand         `command:"stats" env-namespace:"STATS" description:"price per m² statistics of stored offers"`
+	Export        cmd.ExportCommand        `command:"export" env-namespace:"EXPORT" description:"export stored offers to csv, json lines or parquet"`
+	Migrate       cmd.MigrateCommand       `command:"migrate" env-namespace:"MIGRATE" description:"copy all records between engines"`
+	Relayout      cmd.RelayoutCommand      `command:"relayout" env-namespace:"RELAYOUT" description:"move records of the file store to another sharding"`
+	Rewrite       cmd.RewriteCommand       `command:"rewrite" description:"rewrite all records with the current compression and encryption key"`
 
-	PrimaryMarketPLURL    string `long:"url" env:"URL" required:"true" description:"RynekPierwotny.pl url"`
-	PrimaryMarketAPIPLURL string `long:"api-url" env:"API_URL" required:"true" description:"RynekPierwotny.pl api url"`
+	ConfigFile string `long:"config" env:"CONFIG" description:"yaml configuration file, flags and env override its values"`
+
+	PrimaryMarketPLURL    string `long:"url" env:"URL" description:"RynekPierwotny.pl url"`
+	PrimaryMarketAPIPLURL string `long:"api-url" env:"API_URL" description:"RynekPierwotny.pl api url"`
 
 	FileSystem struct {
 		StorePath string `long:"store-path" env:"STORE_PATH" description:"Store path to directory with execution state"`
 	} `group:"fs" namespace:"fs" env-namespace:"FS"`
 
+	Store  string `long:"store" env:"STORE" choice:"memory" choice:"none" default:"memory" description:"engine used when neither fs store path nor s3 bucket is set, none discards all records"`
+	Memory struct {
+		Snapshot string `long:"snapshot" env:"SNAPSHOT" description:"file records of the memory engine are loaded from on start and saved to after every run and on exit"`
+	} `group:"memory" namespace:"memory" env-namespace:"MEMORY"`
+
+	Compression string `long:"compression" env:"COMPRESSION" choice:"none" choice:"gzip" choice:"zstd" default:"none" description:"compress written records, compressed and uncompressed records are read regardless"`
+	Encryption  struct {
+		Key           string   `long:"key" env:"KEY" description:"base64 encoded AES key records are encrypted with, 16, 24 or 32 bytes"`
+		KeyFile       string   `long:"key-file" env:"KEY_FILE" description:"file with the base64 encoded AES key, used when key is not set"`
+		OldKeys       []string `long:"old-key" env:"OLD_KEYS" env-delim:"," description:"base64 encoded previous keys records written before key rotation are decrypted with"`
+		ReadPlaintext bool     `long:"read-plaintext" env:"READ_PLAINTEXT" description:"read records written before encryption was enabled"`
+	} `group:"encryption" namespace:"encryption" env-namespace:"ENCRYPTION"`
+
 	AWS struct {
 		S3 struct {
 			Bucket string `long:"bucket" env:"BUCKET" description:"Execution state store bucket"`
@@ -43,60 +76,211 @@ type Opts struct {
 	} `group:"aws" namespace:"aws" env-namespace:"AWS"`
 
 	Telegram struct {
-		ChatId int64  `long:"chat-id" env:"CHAT_ID" description:"Chat id notifications will be sent to"`
-		Token  string `long:"token" env:"TOKEN" description:"Token will be used to send notifications"`
+		ChatId     int64               `long:"chat-id" env:"CHAT_ID" description:"Chat id notifications will be sent to"`
+		Token      string              `long:"token" env:"TOKEN" description:"Token will be used to send notifications"`
+		ImageByUrl bool                `long:"image-by-url" env:"IMAGE_BY_URL" description:"Pass image links to telegram instead of uploading images"`
+		Image      ImageProcessingOpts `group:"image" namespace:"image" env-namespace:"IMAGE"`
 	} `group:"telegram" namespace:"telegram" env-namespace:"TELEGRAM"`
 
-	Debug bool `long:"debug" env:"DEBUG" description:"debug mode"`
+	Image struct {
+		MaxSize int64         `long:"max-size" env:"MAX_SIZE" default:"5242880" description:"Maximum size of downloaded image in bytes"`
+		Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"30s" description:"Image download timeout"`
+		MaxAge  time.Duration `long:"max-age" env:"MAX_AGE" default:"1h" description:"Images fetched within the age are served from the cache without requests"`
+		TTL     time.Duration `long:"ttl" env:"TTL" default:"720h" description:"Cached images not fetched or revalidated within the ttl are removed after runs, 0 keeps them"`
+	} `group:"image" namespace:"image" env-namespace:"IMAGE"`
+
+	Metrics struct {
+		Listen  string `long:"listen" env:"LISTEN" description:"Address metrics and health endpoints are served on, e.g. :8080"`
+		PushUrl string `long:"push-url" env:"PUSH_URL" description:"Pushgateway url metrics are pushed to when command finishes"`
+		Job     string `long:"job" env:"JOB" default:"rynek-pierwotny-updates" description:"Pushgateway job name"`
+	} `group:"metrics" namespace:"metrics" env-namespace:"METRICS"`
+
+	Health struct {
+		MaxMissedRuns int `long:"max-missed-runs" env:"MAX_MISSED_RUNS" default:"3" description:"Watch intervals without finished run after which the process is unhealthy"`
+		ErrorBudget   int `long:"error-budget" env:"ERROR_BUDGET" default:"3" description:"Consecutive failed runs after which the process is unhealthy"`
+	} `group:"health" namespace:"health" env-namespace:"HEALTH"`
+
+	LogFormat string `long:"log-format" env:"LOG_FORMAT" choice:"text" choice:"json" default:"text" description:"Log format"`
+	Debug     bool   `long:"debug" env:"DEBUG" description:"debug mode"`
+}
+
+// ImageProcessingOpts configures images processing for a writer
+type ImageProcessingOpts struct {
+	Format        string `long:"format" env:"FORMAT" choice:"jpeg" description:"Image format images are converted to"`
+	MaxDimension  int    `long:"max-dimension" env:"MAX_DIMENSION" description:"Maximum image width and height, bigger images are downscaled"`
+	Quality       int    `long:"quality" env:"QUALITY" description:"Jpeg quality"`
+	StripMetadata bool   `long:"strip-metadata" env:"STRIP_METADATA" description:"Remove image metadata"`
+}
+
+func (o ImageProcessingOpts) options() media.ProcessOptions {
+	return media.ProcessOptions{
+		Format:        o.Format,
+		MaxDimension:  o.MaxDimension,
+		Quality:       o.Quality,
+		StripMetadata: o.StripMetadata,
+	}
 }
 
 func main() {
 	var opts Opts
 	p := flags.NewParser(&opts, flags.Default)
+	setCommandEnvNamespaces(p, opts)
+	cfg, cfgErr := loadConfig(p, os.Args[1:])
 	p.CommandHandler = func(command flags.Commander, args []string) error {
-		setupLog(opts.Debug)
+		if c, ok := command.(cmd.StdoutCommander); ok && c.WritesStdout() {
+			logging.SetupOut(opts.LogFormat, opts.Debug, os.Stderr)
+		} else {
+			logging.Setup(opts.LogFormat, opts.Debug)
+		}
 
-		eng, err := setupEngine(opts)
+		if cfgErr != nil {
+			log.Printf("[ERROR] invalid config file: %v", cfgErr)
+			return cmd.ConfigError(cfgErr)
+		}
+		if c, ok := command.(cmd.ConfigCommander); ok {
+			c.SetConfig(cfg)
+			return c.Execute(args)
+		}
+		if c, ok := command.(cmd.ApiCommander); ok {
+			if opts.PrimaryMarketAPIPLURL == "" {
+				return cmd.ConfigError(errors.New("api-url is required"))
+			}
+			c.SetApi(api.NewHttpApi(opts.PrimaryMarketAPIPLURL))
+			return c.Execute(args)
+		}
+		if c, ok := command.(cmd.StorePathCommander); ok {
+			c.SetStorePath(opts.FileSystem.StorePath)
+			return c.Execute(args)
+		}
+		if c, ok := command.(cmd.EngineOpenerCommander); ok {
+			c.SetEngineOpener(func(url string) (engine.Engine, error) {
+				eng, err := registry.Open(url)
+				if err != nil {
+					return nil, err
+				}
+				return wrapEngine(opts, logging.NewEngine(eng, url))
+			})
+			return c.Execute(args)
+		}
+		if c, ok := command.(cmd.StoreCommander); ok {
+			eng, snapshot, err := setupEngine(opts)
+			if err != nil {
+				log.Printf("[ERROR] failed with %+v", err)
+				return &cmd.Error{Kind: cmd.KindStorage, Err: err}
+			}
+			if eng, err = wrapEngine(opts, eng); err != nil {
+				log.Printf("[ERROR] invalid store configuration: %v", err)
+				return cmd.ConfigError(err)
+			}
+			c.SetEngine(eng)
+			if err := c.Execute(args); err != nil {
+				return err
+			}
+			// rewritten records of the memory store are kept only once saved to the snapshot
+			if err := snapshot(); err != nil {
+				log.Printf("[ERROR] can't save memory snapshot: %v", err)
+				return &cmd.Error{Kind: cmd.KindStorage, Err: err}
+			}
+			return nil
+		}
+		if err := validateOpts(opts, cfg); err != nil {
+			log.Printf("[ERROR] invalid configuration: %v", err)
+			return cmd.ConfigError(err)
+		}
+
+		monitor := health.NewMonitor(util.EagerClock{}, opts.OffersUpdates.Watch, opts.Health.MaxMissedRuns, opts.Health.ErrorBudget)
+		srv := setupHttpServer(opts, monitor)
+		defer shutdownHttpServer(srv)
+
+		eng, snapshot, err := setupEngine(opts)
 		if err != nil {
 			log.Printf("[ERROR] failed with %+v", err)
-			return err
+			return &cmd.Error{Kind: cmd.KindStorage, Err: err}
+		}
+		// dry run must leave the memory engine snapshot as it was
+		if opts.OffersUpdates.DryRun {
+			snapshot = func() error { return nil }
+		}
+		defer func() {
+			if err := snapshot(); err != nil {
+				log.Printf("[ERROR] can't save memory engine snapshot: %v", err)
+			}
+		}()
+		if eng, err = wrapEngine(opts, eng); err != nil {
+			log.Printf("[ERROR] invalid store configuration: %v", err)
+			return cmd.ConfigError(err)
 		}
 
 		offerStore, err := setupOfferStore(eng)
 		if err != nil {
 			log.Printf("[ERROR] failed with %+v", err)
-			return err
+			return &cmd.Error{Kind: cmd.KindStorage, Err: err}
 		}
 
 		botApi, err := setupBotApi(opts)
 		if err != nil {
 			log.Printf("[ERROR] failed with %+v", err)
-			return err
+			return cmd.ConfigError(err)
+		}
+
+		imageFetcher, pruneImages := setupImageFetcher(opts, eng)
+		offerNotifier, err := setupOfferWriter(opts, botApi)
+		if err != nil {
+			log.Printf("[ERROR] failed with %+v", err)
+			return cmd.ConfigError(err)
+		}
+
+		primaryMarketAPI := api.NewHttpApi(opts.PrimaryMarketAPIPLURL)
+		profiles, err := setupProfiles(opts, cfg, primaryMarketAPI, eng, botApi)
+		if err != nil {
+			log.Printf("[ERROR] failed with %+v", err)
+			return cmd.ConfigError(err)
 		}
 
-		httpClient := http.Client{}
-		offerNotifier := setupOfferWriter(opts, botApi)
+		monitor.SetReady()
 
 		c := command.(cmd.CommonCommander)
 		c.SetCommon(cmd.CommonOpts{
 			PrimaryMarketURL: opts.PrimaryMarketPLURL,
-			PrimaryMarketAPI: api.NewHttpApi(opts.PrimaryMarketAPIPLURL),
+			PrimaryMarketAPI: primaryMarketAPI,
 			OfferStore:       *offerStore,
+			PropertyStore:    store.NewPropertyFileStore(eng),
 			OfferWriter:      *offerNotifier,
 			Clock:            util.EagerClock{},
-			HttpClient:       httpClient,
+			ImageFetcher:     imageFetcher,
+			Health:           monitor,
+			Snapshot:         snapshot,
+			PruneImages:      pruneImages,
+			Profiles:         profiles,
 		})
 		err = c.Execute(args)
 		if err != nil {
 			log.Printf("[ERROR] failed with %+v", err)
 		}
+		pushMetrics(opts)
 		return err
 	}
 	if _, err := p.Parse(); err != nil {
-		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
-			os.Exit(0)
-		} else {
-			os.Exit(1)
+		if flagsErr, ok := err.(*flags.Error); ok {
+			if flagsErr.Type == flags.ErrHelp {
+				os.Exit(cmd.ExitOk)
+			}
+			os.Exit(cmd.ExitConfig)
+		}
+		os.Exit(cmd.ExitCode(err))
+	}
+}
+
+// setCommandEnvNamespaces applies env-namespace tags of commands, go-flags reads them for option groups only
+func setCommandEnvNamespaces(p *flags.Parser, opts Opts) {
+	t := reflect.TypeOf(opts)
+	for i := 0; i < t.NumField(); i++ {
+		name, namespace := t.Field(i).Tag.Get("command"), t.Field(i).Tag.Get("env-namespace")
+		if name == "" || namespace == "" {
+			continue
+		}
+		if c := p.Find(name); c != nil {
+			c.EnvNamespace = namespace
 		}
 	}
 }
@@ -110,51 +294,256 @@ func setupBotApi(opts Opts) (*tgbotapi.BotAPI, error) {
 	return nil, nil
 }
 
-func setupOfferWriter(opts Opts, botAPI *tgbotapi.BotAPI) *writer.MessageWriter {
+// loadConfig loads configuration file passed with --config and applies its options to the parser
+func loadConfig(p *flags.Parser, args []string) (*config.Config, error) {
+	path := config.Path(args)
+	if path == "" {
+		return nil, nil
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Apply(p)
+}
+
+// validateOpts checks options required by commands working with offers
+func validateOpts(opts Opts, cfg *config.Config) error {
+	if opts.PrimaryMarketPLURL == "" || opts.PrimaryMarketAPIPLURL == "" {
+		return errors.New("url and api-url are required")
+	}
+	if cfg != nil {
+		return cfg.Validate()
+	}
+	return nil
+}
+
+func setupOfferWriter(opts Opts, botAPI *tgbotapi.BotAPI) (*writer.MessageWriter, error) {
 	var w writer.MessageWriter
-	w = &writer.LogWriter{}
+	w = metrics.NewWriter(&writer.LogWriter{}, "log")
 	if botAPI != nil && opts.Telegram.ChatId != 0 {
-		log.Print("[DEBUG] Telegram writer initialized.")
-		w = telegram.NewWriter(opts.Telegram.ChatId, botAPI)
+		tw, err := setupTelegramWriter(opts, botAPI, opts.Telegram.ChatId)
+		if err != nil {
+			return nil, err
+		}
+		w = tw
 	}
-	return &w
+	return &w, nil
 }
 
-func setupEngine(opts Opts) (engine.Engine, error) {
-	if opts.AWS.S3.Bucket != "" && opts.AWS.Region != "" {
-		endpoint := stringOrNil(opts.AWS.Endpoint)
-		sess, err := session.NewSession(&aws.Config{
-			Region:           aws.String(opts.AWS.Region),
-			Endpoint:         endpoint,
-			DisableSSL:       aws.Bool(endpoint != nil),
-			S3ForcePathStyle: aws.Bool(endpoint != nil),
-		})
+func setupTelegramWriter(opts Opts, botAPI *tgbotapi.BotAPI, chatId int64) (writer.MessageWriter, error) {
+	log.Printf("[DEBUG] Telegram writer for chat %v initialized.", chatId)
+	tw := telegram.NewWriter(chatId, botAPI)
+	tw.ImageByUrl = opts.Telegram.ImageByUrl
+
+	imageOpts := opts.Telegram.Image.options()
+	if err := imageOpts.Validate(); err != nil {
+		return nil, err
+	}
+	return metrics.NewWriter(writer.NewImageProcessingWriter(tw, imageOpts), "telegram"), nil
+}
+
+// setupProfiles creates config file profiles, every profile writes to own writers and keeps offers in own store.
+// Region names of profiles are resolved to ids.
+func setupProfiles(opts Opts, cfg *config.Config, primaryMarketAPI api.Api, eng engine.Engine, botAPI *tgbotapi.BotAPI) ([]cmd.Profile, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	profiles := make([]cmd.Profile, 0, len(cfg.Profiles))
+	for _, p := range cfg.Profiles {
+		regions, err := api.ResolveRegions(primaryMarketAPI, p.Regions)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		w, err := setupProfileWriter(opts, p, botAPI)
 		if err != nil {
 			return nil, err
 		}
-		svc := as3.New(sess)
-		eng, err := s3.NewEngine(opts.AWS.S3.Bucket, svc)
-		return eng, err
+		profiles = append(profiles, cmd.Profile{
+			Name:          p.Name,
+			Regions:       regions,
+			Filter:        p.Filter,
+			OfferWriter:   w,
+			OfferStore:    store.NewFallbackOfferFileStore(eng, cmd.ProfilePrefix(p.Name)),
+			PropertyStore: store.NewFallbackPropertyFileStore(eng, cmd.ProfilePrefix(p.Name)),
+		})
+	}
+	return profiles, nil
+}
+
+func setupProfileWriter(opts Opts, profile config.Profile, botAPI *tgbotapi.BotAPI) (writer.MessageWriter, error) {
+	var writers writer.MultiWriter
+	for _, w := range profile.Writers {
+		switch w.Type {
+		case config.WriterTelegram:
+			if botAPI == nil {
+				return nil, fmt.Errorf("profile %s: telegram token is required", profile.Name)
+			}
+			tw, err := setupTelegramWriter(opts, botAPI, w.ChatId)
+			if err != nil {
+				return nil, err
+			}
+			writers = append(writers, tw)
+		case config.WriterLog:
+			writers = append(writers, metrics.NewWriter(&writer.LogWriter{}, "log"))
+		}
+	}
+	if len(writers) == 1 {
+		return writers[0], nil
+	}
+	return writers, nil
+}
+
+// setupEngine creates the configured engine, the returned function saves the memory engine snapshot and has to be
+// called on exit
+func setupEngine(opts Opts) (engine.Engine, func() error, error) {
+	noSnapshot := func() error { return nil }
+	if opts.AWS.S3.Bucket != "" && opts.AWS.Region != "" {
+		eng, err := s3.NewRegionEngine(opts.AWS.S3.Bucket, opts.AWS.Region, opts.AWS.Endpoint)
+		if err != nil {
+			return nil, noSnapshot, err
+		}
+		return instrumentEngine(eng, "s3"), noSnapshot, nil
 	}
 	if opts.FileSystem.StorePath != "" {
 		eng, err := file.NewSystemEngine(opts.FileSystem.StorePath)
-		return eng, err
+		return instrumentEngine(eng, "file"), noSnapshot, err
+	}
+	if opts.Store == "none" {
+		log.Print("[WARN] --store=none discards all records, every offer is notified as new on every run")
+		return instrumentEngine(mock.NewEngine(), "mock"), noSnapshot, nil
+	}
+	if opts.Memory.Snapshot == "" {
+		log.Print("[WARN] No store configured, records are kept in memory and lost on exit, " +
+			"set --fs.store-path, --aws.s3.bucket or --memory.snapshot to keep them")
+		return instrumentEngine(memory.NewEngine(), "memory"), noSnapshot, nil
+	}
+	eng, err := memory.NewSnapshotEngine(opts.Memory.Snapshot)
+	if err != nil {
+		return nil, noSnapshot, err
+	}
+	return instrumentEngine(eng, "memory"), eng.Snapshot, nil
+}
+
+// instrumentEngine logs and records metrics of all operations of the engine
+func instrumentEngine(eng engine.Engine, backend string) engine.Engine {
+	return metrics.NewEngine(logging.NewEngine(eng, backend), backend)
+}
+
+// wrapEngine applies encryption and compression to records of the engine, records are compressed before they are
+// encrypted
+func wrapEngine(opts Opts, eng engine.Engine) (engine.Engine, error) {
+	keys, err := encryptionKeys(opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		if eng, err = encryption.NewEngine(eng, keys, opts.Encryption.ReadPlaintext); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Compression != "" && opts.Compression != "none" {
+		return compression.NewEngine(eng, opts.Compression)
 	}
-	eng := mock.NewEngine()
 	return eng, nil
 }
 
+// encryptionKeys returns the current key followed by old ones, no keys when encryption is not configured
+func encryptionKeys(opts Opts) ([][]byte, error) {
+	var current []byte
+	var err error
+	switch {
+	case opts.Encryption.Key != "":
+		current, err = encryption.ParseKey(opts.Encryption.Key)
+	case opts.Encryption.KeyFile != "":
+		current, err = encryption.ReadKeyFile(opts.Encryption.KeyFile)
+	case len(opts.Encryption.OldKeys) > 0:
+		return nil, errors.New("old encryption keys are set without the current key")
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := [][]byte{current}
+	for _, encoded := range opts.Encryption.OldKeys {
+		k, err := encryption.ParseKey(encoded)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
 func setupOfferStore(engine engine.Engine) (*store.OfferStore, error) {
 	fs := store.NewOfferFileStore(engine)
 	return &fs, nil
 }
 
-func setupLog(dbg bool) {
-	if dbg {
-		log.Setup(log.Debug, log.CallerFile, log.CallerFunc, log.Msec, log.LevelBraces)
+// setupImageFetcher creates the caching image fetcher, the returned function removes cached images expired after
+// the ttl and is nil when they are kept
+func setupImageFetcher(opts Opts, eng engine.Engine) (media.Fetcher, func() error) {
+	fetcher := media.NewHttpFetcher(http.Client{Timeout: opts.Image.Timeout}, opts.Image.MaxSize)
+	images := store.NewImageFileStore(eng)
+	// dry run reads cached images but doesn't cache fetched ones
+	if opts.OffersUpdates.DryRun {
+		images = store.NewReadOnlyImageStore(images)
+	}
+	clock := util.EagerClock{}
+	cachingFetcher := media.NewCachingFetcher(fetcher, images, clock, opts.Image.MaxAge)
+	if opts.Image.TTL <= 0 {
+		return cachingFetcher, nil
+	}
+	return cachingFetcher, func() error {
+		removed, err := images.Prune(clock.Now().Add(-opts.Image.TTL))
+		log.Printf("[DEBUG] Removed %d expired cached image records", removed)
+		return err
+	}
+}
+
+// setupHttpServer starts serving metrics and health endpoints in background when listen address is configured
+func setupHttpServer(opts Opts, monitor *health.Monitor) *http.Server {
+	if opts.Metrics.Listen == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", monitor.HealthHandler())
+	mux.Handle("/readyz", monitor.ReadyHandler())
+	srv := &http.Server{Addr: opts.Metrics.Listen, Handler: mux}
+	go func() {
+		log.Printf("[INFO] Serving metrics and health endpoints on %v..", opts.Metrics.Listen)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("[ERROR] Http server failed with %+v", err)
+		}
+	}()
+	return srv
+}
+
+func shutdownHttpServer(srv *http.Server) {
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("[WARN] Can't shutdown http server: %v", err)
+	}
+}
+
+// pushMetrics pushes metrics of finished command to the pushgateway when it is configured
+func pushMetrics(opts Opts) {
+	if opts.Metrics.PushUrl == "" {
 		return
 	}
-	log.Setup(log.Msec, log.LevelBraces)
+	log.Printf("[DEBUG] Pushing metrics to %v..", opts.Metrics.PushUrl)
+	if err := metrics.Push(opts.Metrics.PushUrl, opts.Metrics.Job); err != nil {
+		log.Printf("[WARN] Can't push metrics: %v", err)
+	}
 }
 
 // getDump reads runtime stack and returns as a string
@@ -171,7 +560,7 @@ func getDump() string {
 // nolint:gochecknoinits // can't avoid it in this place
 func init() {
 	// catch SIGQUIT and print stack traces
-	sigChan := make(chan os.Signal)
+	sigChan := make(chan os.Signal, 1)
 	go func() {
 		for range sigChan {
 			log.Printf("[INFO] SIGQUIT detected, dump:\n%s", getDump())
@@ -179,10 +568,3 @@ func init() {
 	}()
 	signal.Notify(sigChan, syscall.SIGQUIT)
 }
-
-func stringOrNil(s string) *string {
-	if s != "" {
-		return &s
-	}
-	return nil
-}
@@ -0,0 +1,141 @@
+package media
+
+import (
+	"errors"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/util"
+	log "github.com/go-pkgz/lgr"
+	"sync"
+	"time"
+)
+
+// CachingFetcher keeps fetched images in the image store. Images fetched within max age are served from the cache
+// without requests, older ones are revalidated with conditional requests or downloaded again when the server sent
+// no validators.
+type CachingFetcher struct {
+	fetcher *HttpFetcher
+	images  store.ImageStore
+	clock   util.Clock
+	maxAge  time.Duration
+
+	lock sync.Mutex
+	// recent keeps images fetched by the process, so an image is requested once within max age
+	recent map[string]recentImage
+}
+
+type recentImage struct {
+	image     Image
+	fetchedAt time.Time
+}
+
+func NewCachingFetcher(fetcher *HttpFetcher, images store.ImageStore, clock util.Clock, maxAge time.Duration) *CachingFetcher {
+	return &CachingFetcher{fetcher: fetcher, images: images, clock: clock, maxAge: maxAge, recent: map[string]recentImage{}}
+}
+
+func (f *CachingFetcher) Fetch(url string) (Image, error) {
+	if img, ok := f.recentImage(url); ok {
+		log.Printf("[DEBUG] Image %v fetched recently, using it..", url)
+		return img, nil
+	}
+
+	cached, content, ok := f.cached(url)
+	if !ok {
+		return f.fetchAndStore(url)
+	}
+	cachedImg := Image{
+		Url:          url,
+		ContentType:  cached.ContentType,
+		Bytes:        content,
+		Hash:         cached.Hash,
+		ETag:         cached.ETag,
+		LastModified: cached.LastModified,
+	}
+	if f.fresh(cached.FetchedAt) {
+		log.Printf("[DEBUG] Cached image %v is fresh, using it..", url)
+		f.remember(cachedImg, cached.FetchedAt)
+		return cachedImg, nil
+	}
+	if cached.ETag == "" && cached.LastModified == "" {
+		return f.fetchAndStore(url)
+	}
+
+	img, err := f.fetcher.FetchIfModified(url, cached.ETag, cached.LastModified)
+	if err == ErrNotModified {
+		log.Printf("[DEBUG] Image %v not modified, using cached one..", url)
+		// revalidated image is saved with the new fetch time, so it doesn't expire from the cache while in use
+		f.save(cachedImg)
+		return cachedImg, nil
+	}
+	if err != nil {
+		return Image{}, err
+	}
+	f.save(img)
+	return img, nil
+}
+
+func (f *CachingFetcher) fetchAndStore(url string) (Image, error) {
+	img, err := f.fetcher.Fetch(url)
+	if err != nil {
+		return Image{}, err
+	}
+	f.save(img)
+	return img, nil
+}
+
+// recentImage returns the image fetched by the process within max age
+func (f *CachingFetcher) recentImage(url string) (Image, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	r, ok := f.recent[url]
+	if !ok || !f.fresh(r.fetchedAt) {
+		return Image{}, false
+	}
+	return r.image, true
+}
+
+func (f *CachingFetcher) remember(img Image, fetchedAt time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.recent[img.Url] = recentImage{image: img, fetchedAt: fetchedAt}
+}
+
+func (f *CachingFetcher) fresh(fetchedAt time.Time) bool {
+	return f.clock.Now().Sub(fetchedAt) < f.maxAge
+}
+
+// cached returns cached image with its content, reports false when nothing is cached for the url
+func (f *CachingFetcher) cached(url string) (store.Image, []byte, bool) {
+	cached, err := f.images.Get(url)
+	if err != nil {
+		if !errors.Is(err, engine.ErrNotFound) {
+			log.Printf("[WARN] Can't read cached image %v: %v", url, err)
+		}
+		return store.Image{}, nil, false
+	}
+	content, err := f.images.GetContent(cached.Hash)
+	if err != nil {
+		log.Printf("[WARN] Can't read cached image content %v: %v", cached.Hash, err)
+		return store.Image{}, nil, false
+	}
+	return cached, content, true
+}
+
+// save stores image in the cache, failures are not fatal as the image is already fetched
+func (f *CachingFetcher) save(img Image) {
+	now := f.clock.Now()
+	f.remember(img, now)
+	err := f.images.Save(store.Image{
+		Url:          img.Url,
+		Hash:         img.Hash,
+		ContentType:  img.ContentType,
+		ETag:         img.ETag,
+		LastModified: img.LastModified,
+		FetchedAt:    now,
+	}, img.Bytes)
+	if err != nil {
+		log.Printf("[WARN] Can't cache image %v: %v", img.Url, err)
+	}
+}
@@ -0,0 +1,167 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCachingFetcher_Fetch_NotModified(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == "\"v1\"" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("ETag", "\"v1\"")
+		_, _ = fmt.Fprint(w, "yay")
+	}))
+	defer server.Close()
+	fetcher := NewCachingFetcher(NewHttpFetcher(http.Client{}, 0), store.NewImageFileStore(memory.NewEngine()), mockClock{}, 0)
+
+	first, err := fetcher.Fetch(server.URL + "/1.jpg")
+	require.NoError(t, err)
+	second, err := fetcher.Fetch(server.URL + "/1.jpg")
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, first, second)
+	assert.Equal(t, []byte("yay"), second.Bytes)
+}
+
+func TestCachingFetcher_Fetch_ReadOnly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = fmt.Fprint(w, "yay")
+	}))
+	defer server.Close()
+	eng := memory.NewEngine()
+	fetcher := NewCachingFetcher(NewHttpFetcher(http.Client{}, 0), store.NewReadOnlyImageStore(store.NewImageFileStore(eng)), mockClock{}, 0)
+
+	img, err := fetcher.Fetch(server.URL + "/1.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("yay"), img.Bytes)
+	assert.Empty(t, eng.Records(), "fetched image is not cached")
+}
+
+func TestCachingFetcher_Fetch_Modified(t *testing.T) {
+	content := "yay"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("ETag", "\""+content+"\"")
+		_, _ = fmt.Fprint(w, content)
+	}))
+	defer server.Close()
+	fetcher := NewCachingFetcher(NewHttpFetcher(http.Client{}, 0), store.NewImageFileStore(memory.NewEngine()), mockClock{}, 0)
+
+	first, err := fetcher.Fetch(server.URL + "/1.jpg")
+	require.NoError(t, err)
+	content = "yey"
+	second, err := fetcher.Fetch(server.URL + "/1.jpg")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first.Hash, second.Hash)
+	assert.Equal(t, []byte("yey"), second.Bytes)
+}
+
+func TestCachingFetcher_Fetch_MaxAge(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = fmt.Fprint(w, "yay")
+	}))
+	defer server.Close()
+	eng := memory.NewEngine()
+	clock := &movingClock{now: time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)}
+	fetcher := NewCachingFetcher(NewHttpFetcher(http.Client{}, 0), store.NewImageFileStore(eng), clock, time.Hour)
+
+	first, err := fetcher.Fetch(server.URL + "/1.jpg")
+	require.NoError(t, err)
+	second, err := fetcher.Fetch(server.URL + "/1.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests, "image is requested once within a run")
+	assert.Equal(t, first, second)
+
+	restarted := NewCachingFetcher(NewHttpFetcher(http.Client{}, 0), store.NewImageFileStore(eng), clock, time.Hour)
+	third, err := restarted.Fetch(server.URL + "/1.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests, "fresh image without validators is served from the cache")
+	assert.Equal(t, []byte("yay"), third.Bytes)
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	_, err = fetcher.Fetch(server.URL + "/1.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests, "stale image without validators is downloaded again")
+
+	for path := range eng.Records() {
+		assert.True(t, strings.HasPrefix(path, "images/"), path)
+	}
+}
+
+func TestCachingFetcher_Prune(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == "\"v1\"" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("ETag", "\"v1\"")
+		_, _ = fmt.Fprint(w, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer server.Close()
+	eng := memory.NewEngine()
+	images := store.NewImageFileStore(eng)
+	clock := &movingClock{now: time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	_, err := NewCachingFetcher(NewHttpFetcher(http.Client{}, 0), images, clock, time.Hour).Fetch(server.URL + "/1.jpg")
+	require.NoError(t, err)
+	_, err = NewCachingFetcher(NewHttpFetcher(http.Client{}, 0), images, clock, time.Hour).Fetch(server.URL + "/2.jpg")
+	require.NoError(t, err)
+	assert.Len(t, eng.Records(), 4)
+
+	clock.now = clock.now.Add(48 * time.Hour)
+	_, err = NewCachingFetcher(NewHttpFetcher(http.Client{}, 0), images, clock, time.Hour).Fetch(server.URL + "/2.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, 3, requests)
+
+	removed, err := images.Prune(clock.now.Add(-24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed, "image and its content are removed")
+
+	_, err = images.Get(server.URL + "/1.jpg")
+	assert.True(t, errors.Is(err, engine.ErrNotFound), "got %v", err)
+	cached, err := images.Get(server.URL + "/2.jpg")
+	require.NoError(t, err, "revalidated image is kept")
+	content, err := images.GetContent(cached.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2.jpg"), content)
+	assert.Len(t, eng.Records(), 2)
+}
+
+type mockClock struct{}
+
+func (c mockClock) Now() time.Time {
+	return time.Time{}
+}
+
+type movingClock struct {
+	now time.Time
+}
+
+func (c *movingClock) Now() time.Time {
+	return c.now
+}
@@ -0,0 +1,143 @@
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	log "github.com/go-pkgz/lgr"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxSize is a maximum image size in bytes accepted when no other limit is configured
+const DefaultMaxSize int64 = 5 * 1024 * 1024
+
+// sniffLen is an amount of bytes used to detect content type of image served without explicit one
+const sniffLen = 512
+
+type Image struct {
+	Url         string
+	ContentType string
+	Bytes       []byte
+	// Hash is a hex encoded sha256 of image bytes
+	Hash         string
+	ETag         string
+	LastModified string
+}
+
+// ErrNotModified is returned by conditional fetch when the image has not changed since it was fetched last time
+var ErrNotModified = errors.New("image not modified")
+
+type Fetcher interface {
+	Fetch(url string) (Image, error)
+}
+
+type StatusError int
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("unexpected image response status %d", int(e))
+}
+
+type ContentTypeError string
+
+func (e ContentTypeError) Error() string {
+	return fmt.Sprintf("unexpected image content type %s", string(e))
+}
+
+type SizeError int64
+
+func (e SizeError) Error() string {
+	return fmt.Sprintf("image exceeds maximum size of %d bytes", int64(e))
+}
+
+// HttpFetcher downloads images over http validating response status, content type and size
+type HttpFetcher struct {
+	httpClient http.Client
+	maxSize    int64
+}
+
+func NewHttpFetcher(httpClient http.Client, maxSize int64) *HttpFetcher {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	return &HttpFetcher{httpClient: httpClient, maxSize: maxSize}
+}
+
+func (f *HttpFetcher) Fetch(url string) (Image, error) {
+	return f.FetchIfModified(url, "", "")
+}
+
+// FetchIfModified performs conditional request using validators of previously fetched image, returns ErrNotModified when
+// the image has not changed
+func (f *HttpFetcher) FetchIfModified(url string, etag string, lastModified string) (Image, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return Image{}, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	log.Printf("[DEBUG] GET %v", url)
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return Image{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotModified && (etag != "" || lastModified != "") {
+		return Image{}, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Image{}, StatusError(resp.StatusCode)
+	}
+	if resp.ContentLength > f.maxSize {
+		return Image{}, SizeError(f.maxSize)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, f.maxSize+1))
+	if err != nil {
+		return Image{}, err
+	}
+	if int64(len(b)) > f.maxSize {
+		return Image{}, SizeError(f.maxSize)
+	}
+
+	contentType, err := f.contentType(resp.Header.Get("Content-Type"), b)
+	if err != nil {
+		return Image{}, err
+	}
+	hash := sha256.Sum256(b)
+	return Image{
+		Url:          url,
+		ContentType:  contentType,
+		Bytes:        b,
+		Hash:         hex.EncodeToString(hash[:]),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// contentType returns image media type from the header, falls back to content sniffing when the header is not specific
+func (f *HttpFetcher) contentType(header string, b []byte) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil || mediaType == "application/octet-stream" {
+		sniffed := b
+		if len(sniffed) > sniffLen {
+			sniffed = sniffed[:sniffLen]
+		}
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(sniffed))
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", ContentTypeError(mediaType)
+	}
+	return mediaType, nil
+}
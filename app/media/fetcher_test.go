@@ -0,0 +1,84 @@
+package media
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHttpFetcher_Fetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = fmt.Fprint(w, "yay")
+	}))
+	defer server.Close()
+	fetcher := NewHttpFetcher(http.Client{}, 0)
+
+	img, err := fetcher.Fetch(server.URL + "/1.jpg")
+
+	require.NoError(t, err)
+	assert.Equal(t, Image{
+		Url:         server.URL + "/1.jpg",
+		ContentType: "image/jpeg",
+		Bytes:       []byte("yay"),
+		Hash:        "f6078ebe0c2f08c225c0349aef2fe062d71b972e3c91b9687cccdff24d0c8ac8",
+	}, img)
+}
+
+func TestHttpFetcher_Fetch_SniffsContentType(t *testing.T) {
+	png := "\x89PNG\x0D\x0A\x1A\x0A"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = fmt.Fprint(w, png)
+	}))
+	defer server.Close()
+	fetcher := NewHttpFetcher(http.Client{}, 0)
+
+	img, err := fetcher.Fetch(server.URL + "/1.png")
+
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", img.ContentType)
+}
+
+func TestHttpFetcher_Fetch_InvalidStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+	fetcher := NewHttpFetcher(http.Client{}, 0)
+
+	_, err := fetcher.Fetch(server.URL + "/1.jpg")
+
+	assert.Equal(t, StatusError(http.StatusNotFound), err)
+}
+
+func TestHttpFetcher_Fetch_InvalidContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = fmt.Fprint(w, "<html></html>")
+	}))
+	defer server.Close()
+	fetcher := NewHttpFetcher(http.Client{}, 0)
+
+	_, err := fetcher.Fetch(server.URL + "/1.jpg")
+
+	assert.Equal(t, ContentTypeError("text/html"), err)
+}
+
+func TestHttpFetcher_Fetch_TooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.(http.Flusher).Flush()
+		_, _ = fmt.Fprint(w, strings.Repeat("y", 11))
+	}))
+	defer server.Close()
+	fetcher := NewHttpFetcher(http.Client{}, 10)
+
+	_, err := fetcher.Fetch(server.URL + "/1.jpg")
+
+	assert.Equal(t, SizeError(10), err)
+}
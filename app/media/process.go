@@ -0,0 +1,127 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register webp decoder
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	FormatOriginal = ""
+	FormatJpeg     = "jpeg"
+)
+
+// DefaultJpegQuality is used when jpeg quality is not configured
+const DefaultJpegQuality = 85
+
+// ProcessOptions describes how image has to be transformed before it is handed over to a writer
+type ProcessOptions struct {
+	// Format is a format the image is encoded to, FormatOriginal keeps format of decoded image
+	Format string
+	// MaxDimension limits width and height of the image keeping its aspect ratio, 0 means no limit
+	MaxDimension int
+	// Quality is a jpeg encoding quality
+	Quality int
+	// StripMetadata re-encodes the image even when nothing else changes, encoders do not write any metadata
+	StripMetadata bool
+}
+
+func (o ProcessOptions) enabled() bool {
+	return o.Format != FormatOriginal || o.MaxDimension > 0 || o.StripMetadata
+}
+
+func (o ProcessOptions) Validate() error {
+	if o.Format != FormatOriginal && o.Format != FormatJpeg {
+		return fmt.Errorf("unsupported image format %s", o.Format)
+	}
+	if o.MaxDimension < 0 {
+		return fmt.Errorf("invalid max image dimension %d", o.MaxDimension)
+	}
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("invalid jpeg quality %d", o.Quality)
+	}
+	return nil
+}
+
+// Process decodes the image, downscales it to fit max dimension and encodes it again in the requested format
+func Process(b []byte, opts ProcessOptions) ([]byte, error) {
+	if !opts.enabled() {
+		return b, nil
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	img = downscale(img, opts.MaxDimension)
+
+	if opts.Format != FormatOriginal {
+		format = opts.Format
+	}
+	return encode(img, format, opts.Quality)
+}
+
+// downscale resizes the image so that none of its dimensions exceeds max, smaller images are returned untouched
+func downscale(img image.Image, max int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if max <= 0 || (width <= max && height <= max) {
+		return img
+	}
+
+	if width >= height {
+		height = height * max / width
+		width = max
+	} else {
+		width = width * max / height
+		height = max
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
+
+func encode(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	case FormatJpeg:
+		if quality == 0 {
+			quality = DefaultJpegQuality
+		}
+		err = jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: quality})
+	default:
+		// there is no encoder for the format (e.g. webp), png keeps the image lossless
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flatten draws the image on a white background as jpeg does not support transparency
+func flatten(img image.Image) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
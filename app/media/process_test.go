@@ -0,0 +1,60 @@
+package media
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestProcess_DownscaleToJpeg(t *testing.T) {
+	b := testPng(t, 400, 200)
+
+	processed, err := Process(b, ProcessOptions{Format: FormatJpeg, MaxDimension: 100})
+
+	require.NoError(t, err)
+	img, format, err := image.Decode(bytes.NewReader(processed))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), img.Bounds())
+}
+
+func TestProcess_KeepsSmallerImageFormat(t *testing.T) {
+	b := testPng(t, 40, 80)
+
+	processed, err := Process(b, ProcessOptions{MaxDimension: 100})
+
+	require.NoError(t, err)
+	img, format, err := image.Decode(bytes.NewReader(processed))
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, image.Rect(0, 0, 40, 80), img.Bounds())
+}
+
+func TestProcess_Disabled(t *testing.T) {
+	processed, err := Process([]byte("yay"), ProcessOptions{})
+
+	require.NoError(t, err)
+	assert.Equal(t, []byte("yay"), processed)
+}
+
+func TestProcess_InvalidImage(t *testing.T) {
+	_, err := Process([]byte("<html></html>"), ProcessOptions{Format: FormatJpeg})
+
+	assert.Error(t, err)
+}
+
+func testPng(t *testing.T, width int, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"time"
+)
+
+// Engine records latency of all operations of the underlying engine
+type Engine struct {
+	engine  engine.Engine
+	backend string
+}
+
+func NewEngine(engine engine.Engine, backend string) engine.Engine {
+	return &Engine{engine: engine, backend: backend}
+}
+
+func (e *Engine) Read(path string) ([]byte, error) {
+	started := time.Now()
+	b, err := e.engine.Read(path)
+	e.observe("read", started, err)
+	return b, err
+}
+
+func (e *Engine) Write(path string, bytes []byte) error {
+	started := time.Now()
+	err := e.engine.Write(path, bytes)
+	e.observe("write", started, err)
+	return err
+}
+
+func (e *Engine) Exists(path string) (bool, error) {
+	started := time.Now()
+	exists, err := e.engine.Exists(path)
+	e.observe("exists", started, err)
+	return exists, err
+}
+
+func (e *Engine) List(prefix string) ([]string, error) {
+	started := time.Now()
+	paths, err := e.engine.List(prefix)
+	e.observe("list", started, err)
+	return paths, err
+}
+
+func (e *Engine) Delete(path string) error {
+	started := time.Now()
+	err := e.engine.Delete(path)
+	e.observe("delete", started, err)
+	return err
+}
+
+func (e *Engine) observe(operation string, started time.Time, err error) {
+	// missing record is an expected outcome of read
+	if errors.Is(err, engine.ErrNotFound) {
+		err = nil
+	}
+	EngineOperationDuration.WithLabelValues(e.backend, operation, result(err)).Observe(time.Since(started).Seconds())
+}
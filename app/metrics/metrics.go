@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "rynek_pierwotny"
+
+// Registry holds all application metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	OffersFetched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "offers_fetched_total",
+		Help:      "Offers fetched from the API per region.",
+	}, []string{"region"})
+
+	OffersRouted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "offers_routed_total",
+		Help:      "Offers by detected update type.",
+	}, []string{"type"})
+
+	ApiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "API request latency by path and response status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"path", "status"})
+
+	WriterWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "writer_writes_total",
+		Help:      "Messages written per writer backend and result.",
+	}, []string{"backend", "result"})
+
+	EngineOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "engine_operation_duration_seconds",
+		Help:      "Store engine operation latency per backend, operation and result.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"backend", "operation", "result"})
+
+	RunDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "run_duration_seconds",
+		Help:      "Duration of the last run.",
+	})
+
+	LastSuccessfulRun = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_run_timestamp_seconds",
+		Help:      "Unix timestamp of the last run finished without errors.",
+	})
+)
+
+const (
+	RouteNew            = "new"
+	RoutePriceRise      = "price_rise"
+	RoutePriceDrop      = "price_drop"
+	RouteImageChange    = "image_change"
+	RouteSeed           = "seed"
+	RoutePropertyChange = "property_change"
+	RouteQuarantine     = "quarantine"
+)
+
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+// nolint:gochecknoinits // collectors have to be registered before any use
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		OffersFetched,
+		OffersRouted,
+		ApiRequestDuration,
+		WriterWrites,
+		EngineOperationDuration,
+		RunDuration,
+		LastSuccessfulRun,
+	)
+}
+
+// Handler serves metrics in prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Push pushes all metrics to the pushgateway replacing metrics previously pushed by the job
+func Push(url string, job string) error {
+	return push.New(url, job).Gatherer(Registry).Push()
+}
+
+// ObserveApiRequest records API request latency, path is the route template with placeholders instead of ids and
+// status is 0 when request failed without response
+func ObserveApiRequest(path string, status int, started time.Time) {
+	label := "error"
+	if status > 0 {
+		label = strconv.Itoa(status)
+	}
+	ApiRequestDuration.WithLabelValues(path, label).Observe(time.Since(started).Seconds())
+}
+
+// ObserveRun records run duration and time of the last successful run
+func ObserveRun(started time.Time, finished time.Time, err error) {
+	RunDuration.Set(finished.Sub(started).Seconds())
+	if err == nil {
+		LastSuccessfulRun.Set(float64(finished.Unix()))
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultFailure
+	}
+	return resultSuccess
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/writer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	eng := NewEngine(missingEngine{}, "test")
+	_, _ = eng.Read("1.json")
+	w := NewWriter(&writer.LogWriter{}, "test")
+	_, _ = w.Write(writer.Message{Text: "yay"})
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	b, err := ioutil.ReadAll(rec.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "rynek_pierwotny_engine_operation_duration_seconds_count{backend=\"test\",operation=\"read\",result=\"success\"} 1")
+	assert.Contains(t, string(b), "rynek_pierwotny_writer_writes_total{backend=\"test\",result=\"success\"} 1")
+}
+
+type missingEngine struct{}
+
+func (e missingEngine) Read(path string) ([]byte, error) {
+	return make([]byte, 0), engine.NotFound(path)
+}
+
+func (e missingEngine) Write(_ string, _ []byte) error {
+	return nil
+}
+
+func (e missingEngine) Exists(_ string) (bool, error) {
+	return false, nil
+}
+
+func (e missingEngine) List(_ string) ([]string, error) {
+	return nil, nil
+}
+
+func (e missingEngine) Delete(_ string) error {
+	return nil
+}
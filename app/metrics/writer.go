@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/writer"
+)
+
+// Writer counts successful and failed writes of the underlying writer
+type Writer struct {
+	writer  writer.MessageWriter
+	backend string
+}
+
+func NewWriter(writer writer.MessageWriter, backend string) *Writer {
+	return &Writer{writer: writer, backend: backend}
+}
+
+func (w *Writer) Write(message writer.Message) (string, error) {
+	ref, err := w.writer.Write(message)
+	WriterWrites.WithLabelValues(w.backend, result(err)).Inc()
+	return ref, err
+}
+
+func (w *Writer) AcceptsImageUrl() bool {
+	if rw, ok := w.writer.(writer.RemoteImageWriter); ok {
+		return rw.AcceptsImageUrl()
+	}
+	return false
+}
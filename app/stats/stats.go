@@ -0,0 +1,190 @@
+package stats
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"math"
+	"sort"
+)
+
+// monthLayout formats periods of the trend
+const monthLayout = "2006-01"
+
+// Report is price per m² statistics of stored offers grouped by region and by vendor
+type Report struct {
+	Regions []Summary `json:"regions"`
+	Vendors []Summary `json:"vendors"`
+}
+
+// Summary is price per m² statistics of a group of offers
+type Summary struct {
+	Name   string  `json:"name"`
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	P25    float64 `json:"p25"`
+	Median float64 `json:"median"`
+	P75    float64 `json:"p75"`
+	P90    float64 `json:"p90"`
+	Max    float64 `json:"max"`
+	// Change is the relative change of the median between the first and the last period of the trend
+	Change float64  `json:"change"`
+	Trend  []Period `json:"trend"`
+}
+
+// Period is the median price per m² of offers known at the end of the month
+type Period struct {
+	Month  string  `json:"month"`
+	Count  int     `json:"count"`
+	Median float64 `json:"median"`
+}
+
+// PricePerSqm calculates price per m² of price and area ranges as an average of the cheapest and the most
+// expensive ends, reports false when price or area is unknown
+func PricePerSqm(priceMin int64, priceMax int64, areaMin int, areaMax int) (float64, bool) {
+	var values []float64
+	if priceMin > 0 && areaMin > 0 {
+		values = append(values, float64(priceMin)/float64(areaMin))
+	}
+	if priceMax > 0 && areaMax > 0 {
+		values = append(values, float64(priceMax)/float64(areaMax))
+	}
+	if len(values) == 0 {
+		return 0, false
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values)), true
+}
+
+// OfferPricePerSqm calculates current price per m² of the offer
+func OfferPricePerSqm(offer store.Offer) (float64, bool) {
+	return PricePerSqm(offer.PriceMin, offer.PriceMax, offer.AreaMin, offer.AreaMax)
+}
+
+// Compute calculates statistics of offers with known price and area, groups are sorted by name
+func Compute(offers []store.Offer) Report {
+	return Report{
+		Regions: summarize(groupBy(offers, func(o store.Offer) string { return o.RegionName })),
+		Vendors: summarize(groupBy(offers, func(o store.Offer) string { return o.VendorSlug })),
+	}
+}
+
+// RegionMedians calculates the median price per m² of every region having at least minOffers offers with known
+// price and area
+func RegionMedians(offers []store.Offer, minOffers int) map[string]float64 {
+	medians := map[string]float64{}
+	for region, group := range groupBy(offers, func(o store.Offer) string { return o.RegionName }) {
+		values := currentValues(group)
+		if len(values) == 0 || len(values) < minOffers {
+			continue
+		}
+		medians[region] = percentile(values, 0.5)
+	}
+	return medians
+}
+
+func groupBy(offers []store.Offer, key func(o store.Offer) string) map[string][]store.Offer {
+	groups := map[string][]store.Offer{}
+	for _, o := range offers {
+		groups[key(o)] = append(groups[key(o)], o)
+	}
+	return groups
+}
+
+func summarize(groups map[string][]store.Offer) []Summary {
+	summaries := make([]Summary, 0, len(groups))
+	for name, offers := range groups {
+		values := currentValues(offers)
+		if len(values) == 0 {
+			continue
+		}
+		s := Summary{
+			Name:   name,
+			Count:  len(values),
+			Min:    values[0],
+			P25:    percentile(values, 0.25),
+			Median: percentile(values, 0.5),
+			P75:    percentile(values, 0.75),
+			P90:    percentile(values, 0.9),
+			Max:    values[len(values)-1],
+			Trend:  trend(offers),
+		}
+		if n := len(s.Trend); n > 1 && s.Trend[0].Median > 0 {
+			s.Change = s.Trend[n-1].Median/s.Trend[0].Median - 1
+		}
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
+
+// currentValues returns sorted current price per m² of offers with known price and area
+func currentValues(offers []store.Offer) []float64 {
+	values := make([]float64, 0, len(offers))
+	for _, o := range offers {
+		if v, ok := OfferPricePerSqm(o); ok {
+			values = append(values, v)
+		}
+	}
+	sort.Float64s(values)
+	return values
+}
+
+// trend calculates the median price per m² for every month prices were recorded in, an offer counts in a month
+// with the last price recorded until the end of it
+func trend(offers []store.Offer) []Period {
+	monthSet := map[string]bool{}
+	for _, o := range offers {
+		for _, r := range o.History() {
+			monthSet[r.At.UTC().Format(monthLayout)] = true
+		}
+	}
+	months := make([]string, 0, len(monthSet))
+	for m := range monthSet {
+		months = append(months, m)
+	}
+	sort.Strings(months)
+
+	periods := make([]Period, 0, len(months))
+	for _, m := range months {
+		var values []float64
+		for _, o := range offers {
+			if v, ok := priceAt(o.History(), m); ok {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		sort.Float64s(values)
+		periods = append(periods, Period{Month: m, Count: len(values), Median: percentile(values, 0.5)})
+	}
+	return periods
+}
+
+// priceAt returns price per m² of the last record until the end of the month
+func priceAt(history []store.PriceRecord, month string) (float64, bool) {
+	var last *store.PriceRecord
+	for i := range history {
+		if history[i].At.UTC().Format(monthLayout) > month {
+			break
+		}
+		last = &history[i]
+	}
+	if last == nil {
+		return 0, false
+	}
+	return PricePerSqm(last.PriceMin, last.PriceMax, last.AreaMin, last.AreaMax)
+}
+
+// percentile calculates the percentile of sorted values with linear interpolation between closest ranks
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
@@ -0,0 +1,90 @@
+package stats
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPricePerSqm(t *testing.T) {
+	v, ok := PricePerSqm(500000, 1200000, 50, 100)
+	assert.True(t, ok)
+	assert.Equal(t, 11000.0, v)
+
+	v, ok = PricePerSqm(600000, 0, 50, 100)
+	assert.True(t, ok)
+	assert.Equal(t, 12000.0, v)
+
+	_, ok = PricePerSqm(0, 0, 50, 100)
+	assert.False(t, ok)
+	_, ok = PricePerSqm(500000, 1200000, 0, 0)
+	assert.False(t, ok)
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{10, 20, 30, 40}
+	assert.Equal(t, 10.0, percentile(values, 0))
+	assert.Equal(t, 25.0, percentile(values, 0.5))
+	assert.Equal(t, 37.0, percentile(values, 0.9))
+	assert.Equal(t, 40.0, percentile(values, 1))
+	assert.Equal(t, 0.0, percentile(nil, 0.5))
+}
+
+func TestCompute(t *testing.T) {
+	july := time.Date(2026, 7, 10, 0, 0, 0, 0, time.UTC)
+	august := time.Date(2026, 8, 10, 0, 0, 0, 0, time.UTC)
+	offers := []store.Offer{
+		{Id: 1, RegionName: "Kraków", VendorSlug: "acme", PriceMin: 500000, AreaMin: 50, PriceHistory: []store.PriceRecord{
+			{At: july, PriceMin: 500000, AreaMin: 50},
+		}},
+		{Id: 2, RegionName: "Kraków", VendorSlug: "acme", PriceMin: 600000, AreaMin: 50, PriceHistory: []store.PriceRecord{
+			{At: july, PriceMin: 700000, AreaMin: 50},
+			{At: august, PriceMin: 600000, AreaMin: 50},
+		}},
+		{Id: 3, RegionName: "Kraków", VendorSlug: "foo", PriceMin: 1300000, AreaMin: 100, ImportedAt: august},
+		{Id: 4, RegionName: "Wieliczka", VendorSlug: "foo", PriceMin: 800000, AreaMin: 100, ImportedAt: august},
+		{Id: 5, RegionName: "Wieliczka", VendorSlug: "foo", ImportedAt: august},
+	}
+
+	report := Compute(offers)
+
+	require.Len(t, report.Regions, 2)
+	krakow := report.Regions[0]
+	assert.Equal(t, "Kraków", krakow.Name)
+	assert.Equal(t, 3, krakow.Count)
+	assert.Equal(t, 10000.0, krakow.Min)
+	assert.Equal(t, 12000.0, krakow.Median)
+	assert.Equal(t, 13000.0, krakow.Max)
+	assert.Equal(t, []Period{
+		{Month: "2026-07", Count: 2, Median: 12000},
+		{Month: "2026-08", Count: 3, Median: 12000},
+	}, krakow.Trend)
+	assert.Equal(t, 0.0, krakow.Change)
+
+	wieliczka := report.Regions[1]
+	assert.Equal(t, "Wieliczka", wieliczka.Name)
+	assert.Equal(t, 1, wieliczka.Count)
+	assert.Equal(t, []Period{{Month: "2026-08", Count: 1, Median: 8000}}, wieliczka.Trend)
+
+	require.Len(t, report.Vendors, 2)
+	assert.Equal(t, "acme", report.Vendors[0].Name)
+	assert.Equal(t, 2, report.Vendors[0].Count)
+	assert.InDelta(t, -1.0/12, report.Vendors[0].Change, 0.0001)
+	assert.Equal(t, "foo", report.Vendors[1].Name)
+	assert.Equal(t, 2, report.Vendors[1].Count)
+}
+
+func TestRegionMedians(t *testing.T) {
+	offers := []store.Offer{
+		{RegionName: "Kraków", PriceMin: 500000, AreaMin: 50},
+		{RegionName: "Kraków", PriceMin: 600000, AreaMin: 50},
+		{RegionName: "Kraków", PriceMin: 1300000, AreaMin: 100},
+		{RegionName: "Wieliczka", PriceMin: 800000, AreaMin: 100},
+		{RegionName: "Wieliczka"},
+	}
+
+	assert.Equal(t, map[string]float64{"Kraków": 12000}, RegionMedians(offers, 2))
+	assert.Equal(t, map[string]float64{"Kraków": 12000, "Wieliczka": 8000}, RegionMedians(offers, 0))
+}
@@ -0,0 +1,94 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/klauspost/compress/zstd"
+	"io/ioutil"
+)
+
+// Compression algorithms
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// Magic numbers starting compressed records, records starting otherwise are read as they are
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Engine compresses records written to the wrapped engine. Records are decompressed by their magic number, so records
+// written uncompressed or with another algorithm are read as well.
+type Engine struct {
+	engine    engine.Engine
+	algorithm string
+	encoder   *zstd.Encoder
+	decoder   *zstd.Decoder
+}
+
+func NewEngine(eng engine.Engine, algorithm string) (engine.Engine, error) {
+	if algorithm != Gzip && algorithm != Zstd {
+		return nil, fmt.Errorf("unknown compression %q", algorithm)
+	}
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{engine: eng, algorithm: algorithm, encoder: encoder, decoder: decoder}, nil
+}
+
+func (e *Engine) Read(path string) ([]byte, error) {
+	b, err := e.engine.Read(path)
+	if err != nil {
+		return b, err
+	}
+	switch {
+	case bytes.HasPrefix(b, zstdMagic):
+		return e.decoder.DecodeAll(b, nil)
+	case bytes.HasPrefix(b, gzipMagic):
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	default:
+		return b, nil
+	}
+}
+
+func (e *Engine) Write(path string, b []byte) error {
+	if e.algorithm == Zstd {
+		return e.engine.Write(path, e.encoder.EncodeAll(b, nil))
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return e.engine.Write(path, buf.Bytes())
+}
+
+func (e *Engine) Exists(path string) (bool, error) {
+	return e.engine.Exists(path)
+}
+
+func (e *Engine) List(prefix string) ([]string, error) {
+	return e.engine.List(prefix)
+}
+
+func (e *Engine) Delete(path string) error {
+	return e.engine.Delete(path)
+}
@@ -0,0 +1,51 @@
+package compression
+
+import (
+	"bytes"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/enginetest"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEngine_Conformance(t *testing.T) {
+	for _, algorithm := range []string{Gzip, Zstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			enginetest.Run(t, func(t *testing.T) engine.Engine {
+				eng, err := NewEngine(memory.NewEngine(), algorithm)
+				require.NoError(t, err)
+				return eng
+			})
+		})
+	}
+}
+
+func TestEngine_Read(t *testing.T) {
+	record := bytes.Repeat([]byte("{\"id\":1,\"name\":\"Wille Acme\"}"), 100)
+	backend := memory.NewEngineWith(map[string][]byte{"plain.json": record})
+
+	gz, err := NewEngine(backend, Gzip)
+	require.NoError(t, err)
+	zst, err := NewEngine(backend, Zstd)
+	require.NoError(t, err)
+	require.NoError(t, gz.Write("gzip.json", record))
+	require.NoError(t, zst.Write("zstd.json", record))
+
+	records := backend.Records()
+	assert.Equal(t, gzipMagic, records["gzip.json"][:2])
+	assert.Equal(t, zstdMagic, records["zstd.json"][:4])
+	assert.Less(t, len(records["gzip.json"]), len(record))
+	assert.Less(t, len(records["zstd.json"]), len(record))
+
+	// records written uncompressed or with the other algorithm are read transparently
+	for _, path := range []string{"plain.json", "gzip.json", "zstd.json"} {
+		b, err := zst.Read(path)
+		require.NoError(t, err, path)
+		assert.Equal(t, record, b, path)
+	}
+
+	_, err = NewEngine(backend, "lz4")
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// magic starts encrypted records, it is followed by the id of the key, the nonce and the sealed content
+var magic = []byte("RPE1")
+
+// keyIdSize is the length of key ids, the id is the beginning of the SHA-256 hash of the key
+const keyIdSize = 4
+
+// Engine encrypts records written to the wrapped engine with AES-GCM. Records are written with the first key and read
+// with any of the keys, so a new key can be added in front of old ones and records are re-encrypted as they are
+// written again.
+type Engine struct {
+	engine engine.Engine
+	keys   []key
+	// readPlaintext allows reading records written before encryption was enabled
+	readPlaintext bool
+}
+
+type key struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+// NewEngine creates the engine with AES-128, AES-192 or AES-256 keys, the first key encrypts written records
+func NewEngine(eng engine.Engine, keys [][]byte, readPlaintext bool) (engine.Engine, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("encryption key is required")
+	}
+	e := &Engine{engine: eng, readPlaintext: readPlaintext}
+	for i, k := range keys {
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d: %w", i+1, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(k)
+		e.keys = append(e.keys, key{id: sum[:keyIdSize], aead: aead})
+	}
+	return e, nil
+}
+
+// ParseKey decodes the base64 encoded key
+func ParseKey(encoded string) ([]byte, error) {
+	k, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("key is not base64 encoded: %w", err)
+	}
+	return k, nil
+}
+
+// ReadKeyFile reads the base64 encoded key from the file
+func ReadKeyFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(string(b))
+}
+
+func (e *Engine) Read(path string) ([]byte, error) {
+	b, err := e.engine.Read(path)
+	if err != nil {
+		return b, err
+	}
+	if !bytes.HasPrefix(b, magic) {
+		if e.readPlaintext {
+			return b, nil
+		}
+		return nil, fmt.Errorf("record %s is not encrypted", path)
+	}
+
+	b = b[len(magic):]
+	if len(b) < keyIdSize {
+		return nil, fmt.Errorf("record %s is truncated", path)
+	}
+	id, sealed := b[:keyIdSize], b[keyIdSize:]
+	for _, k := range e.keys {
+		if !bytes.Equal(k.id, id) {
+			continue
+		}
+		if len(sealed) < k.aead.NonceSize() {
+			return nil, fmt.Errorf("record %s is truncated", path)
+		}
+		nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+		plain, err := k.aead.Open(nil, nonce, ciphertext, []byte(path))
+		if err != nil {
+			return nil, fmt.Errorf("can't decrypt record %s: %w", path, err)
+		}
+		return plain, nil
+	}
+	return nil, fmt.Errorf("record %s is encrypted with an unknown key %x", path, id)
+}
+
+// Write encrypts the record with the first key, the path is authenticated so records can't be swapped
+func (e *Engine) Write(path string, b []byte) error {
+	k := e.keys[0]
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	out := make([]byte, 0, len(magic)+keyIdSize+len(nonce)+len(b)+k.aead.Overhead())
+	out = append(out, magic...)
+	out = append(out, k.id...)
+	out = append(out, nonce...)
+	out = k.aead.Seal(out, nonce, b, []byte(path))
+	return e.engine.Write(path, out)
+}
+
+func (e *Engine) Exists(path string) (bool, error) {
+	return e.engine.Exists(path)
+}
+
+func (e *Engine) List(prefix string) ([]string, error) {
+	return e.engine.List(prefix)
+}
+
+func (e *Engine) Delete(path string) error {
+	return e.engine.Delete(path)
+}
@@ -0,0 +1,99 @@
+package encryption
+
+import (
+	"bytes"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/enginetest"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	oldKey = bytes.Repeat([]byte{1}, 32)
+	newKey = bytes.Repeat([]byte{2}, 32)
+)
+
+func TestEngine_Conformance(t *testing.T) {
+	enginetest.Run(t, func(t *testing.T) engine.Engine {
+		eng, err := NewEngine(memory.NewEngine(), [][]byte{newKey}, false)
+		require.NoError(t, err)
+		return eng
+	})
+}
+
+func TestEngine_KeyRotation(t *testing.T) {
+	backend := memory.NewEngine()
+	old, err := NewEngine(backend, [][]byte{oldKey}, false)
+	require.NoError(t, err)
+	require.NoError(t, old.Write("1.json", []byte("{\"id\":1}")))
+	assert.NotContains(t, string(backend.Records()["1.json"]), "\"id\"")
+
+	rotated, err := NewEngine(backend, [][]byte{newKey, oldKey}, false)
+	require.NoError(t, err)
+	b, err := rotated.Read("1.json")
+	require.NoError(t, err)
+	assert.Equal(t, "{\"id\":1}", string(b))
+
+	require.NoError(t, rotated.Write("1.json", []byte("{\"id\":1}")))
+	_, err = old.Read("1.json")
+	assert.Error(t, err, "record is re-encrypted with the new key")
+
+	current, err := NewEngine(backend, [][]byte{newKey}, false)
+	require.NoError(t, err)
+	b, err = current.Read("1.json")
+	require.NoError(t, err)
+	assert.Equal(t, "{\"id\":1}", string(b))
+}
+
+func TestEngine_Read_Failures(t *testing.T) {
+	backend := memory.NewEngineWith(map[string][]byte{"plain.json": []byte("{\"id\":1}")})
+	eng, err := NewEngine(backend, [][]byte{newKey}, false)
+	require.NoError(t, err)
+
+	_, err = eng.Read("plain.json")
+	assert.Error(t, err)
+	plaintext, err := NewEngine(backend, [][]byte{newKey}, true)
+	require.NoError(t, err)
+	b, err := plaintext.Read("plain.json")
+	require.NoError(t, err)
+	assert.Equal(t, "{\"id\":1}", string(b))
+
+	require.NoError(t, eng.Write("1.json", []byte("{\"id\":1}")))
+	sealed := backend.Records()["1.json"]
+
+	// swapped records fail authentication
+	require.NoError(t, backend.Write("2.json", sealed))
+	_, err = eng.Read("2.json")
+	assert.Error(t, err)
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 0xff
+	require.NoError(t, backend.Write("1.json", tampered))
+	_, err = eng.Read("1.json")
+	assert.Error(t, err)
+
+	require.NoError(t, backend.Write("1.json", sealed[:len(magic)+2]))
+	_, err = eng.Read("1.json")
+	assert.Error(t, err)
+
+	_, err = NewEngine(backend, nil, false)
+	assert.Error(t, err)
+	_, err = NewEngine(backend, [][]byte{[]byte("short")}, false)
+	assert.Error(t, err)
+}
+
+func TestReadKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, ioutil.WriteFile(path, []byte("AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=\n"), 0600))
+
+	k, err := ReadKeyFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, newKey, k)
+
+	_, err = ParseKey("not base64!")
+	assert.Error(t, err)
+}
@@ -1,7 +1,35 @@
 package engine
 
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned by engines reading records which don't exist, check it with errors.Is
+var ErrNotFound = errors.New("record not found")
+
 type Engine interface {
+	// Read returns content of the record, the error matches ErrNotFound when it doesn't exist
 	Read(path string) ([]byte, error)
 	Write(path string, bytes []byte) error
 	Exists(path string) (bool, error)
+	// List returns paths of all records starting with the prefix
+	List(prefix string) ([]string, error)
+	// Delete removes the record, missing records are not an error
+	Delete(path string) error
+}
+
+// NotFound returns the error of the missing record matching ErrNotFound
+func NotFound(path string) error {
+	return notFoundError(path)
+}
+
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return fmt.Sprintf("Path %s does not exist", string(e))
+}
+
+func (e notFoundError) Is(target error) bool {
+	return target == ErrNotFound
 }
@@ -0,0 +1,137 @@
+// Package enginetest is a conformance suite every engine.Engine implementation has to pass
+package enginetest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+// Run checks the engine persists records, newEngine creates a new empty engine for every test
+func Run(t *testing.T, newEngine func(t *testing.T) engine.Engine) {
+	RunMissing(t, newEngine)
+
+	t.Run("write and read", func(t *testing.T) {
+		eng := newEngine(t)
+		require.NoError(t, eng.Write("1.json", []byte("{\"id\":1}")))
+
+		b, err := eng.Read("1.json")
+		require.NoError(t, err)
+		assert.Equal(t, "{\"id\":1}", string(b))
+
+		exists, err := eng.Exists("1.json")
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		eng := newEngine(t)
+		require.NoError(t, eng.Write("1.json", []byte("{\"id\":1,\"name\":\"Wille Acme\"}")))
+		require.NoError(t, eng.Write("1.json", []byte("{\"id\":1}")))
+
+		b, err := eng.Read("1.json")
+		require.NoError(t, err)
+		assert.Equal(t, "{\"id\":1}", string(b))
+	})
+
+	t.Run("empty record", func(t *testing.T) {
+		eng := newEngine(t)
+		require.NoError(t, eng.Write("1.json", []byte{}))
+
+		b, err := eng.Read("1.json")
+		require.NoError(t, err)
+		assert.Empty(t, b)
+		exists, err := eng.Exists("1.json")
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("nested paths", func(t *testing.T) {
+		eng := newEngine(t)
+		require.NoError(t, eng.Write("offers/ab/12345.json", []byte("{}")))
+
+		b, err := eng.Read("offers/ab/12345.json")
+		require.NoError(t, err)
+		assert.Equal(t, "{}", string(b))
+
+		_, err = eng.Read("offers/12345.json")
+		assert.True(t, errors.Is(err, engine.ErrNotFound), "got %v", err)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		eng := newEngine(t)
+		for _, p := range []string{"2.json", "1.json", "profile-1.json", "offers/ab/12345.json"} {
+			require.NoError(t, eng.Write(p, []byte("{}")))
+		}
+
+		paths, err := eng.List("")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"1.json", "2.json", "profile-1.json", "offers/ab/12345.json"}, paths)
+
+		paths, err = eng.List("profile-")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"profile-1.json"}, paths)
+
+		paths, err = eng.List("offers/")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"offers/ab/12345.json"}, paths)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		eng := newEngine(t)
+		require.NoError(t, eng.Write("1.json", []byte("{}")))
+		require.NoError(t, eng.Write("offers/ab/12345.json", []byte("{}")))
+
+		require.NoError(t, eng.Delete("1.json"))
+		require.NoError(t, eng.Delete("1.json"), "missing record is not an error")
+
+		exists, err := eng.Exists("1.json")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		paths, err := eng.List("")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"offers/ab/12345.json"}, paths)
+	})
+
+	t.Run("concurrent writes", func(t *testing.T) {
+		eng := newEngine(t)
+		wg := sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				assert.NoError(t, eng.Write(fmt.Sprintf("%d.json", i), []byte(fmt.Sprintf("{\"id\":%d}", i))))
+			}(i)
+		}
+		wg.Wait()
+
+		paths, err := eng.List("")
+		require.NoError(t, err)
+		assert.Len(t, paths, 20)
+		b, err := eng.Read("7.json")
+		require.NoError(t, err)
+		assert.Equal(t, "{\"id\":7}", string(b))
+	})
+}
+
+// RunMissing checks reads of missing records, engines which don't persist records have to pass it
+func RunMissing(t *testing.T, newEngine func(t *testing.T) engine.Engine) {
+	t.Run("missing record", func(t *testing.T) {
+		eng := newEngine(t)
+
+		_, err := eng.Read("1.json")
+		assert.True(t, errors.Is(err, engine.ErrNotFound), "got %v", err)
+
+		exists, err := eng.Exists("1.json")
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		paths, err := eng.List("")
+		require.NoError(t, err)
+		assert.Empty(t, paths)
+	})
+}
@@ -2,79 +2,270 @@ package file
 
 import (
 	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
 	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 )
 
 const filePermission = 0644
 
+// tempFilePrefix starts names of files being written, they are renamed to the record name when complete
+const tempFilePrefix = "."
+
+// tempFileMarker follows the record name in names of temporary files
+const tempFileMarker = ".tmp-"
+
+// Engine stores records as files under the base directory, slash separated paths of records are nested directories
 type Engine struct {
-	baseDir string
-	lock    sync.Mutex
+	baseDir  string
+	sharding Sharding
+	lock     sync.Mutex
 }
 
+// NewSystemEngine opens the engine with the layout records of the directory are stored with, new stores are flat
 func NewSystemEngine(basePath string) (engine.Engine, error) {
-	baseDir := strings.TrimRight(basePath, "/")
-	eng := Engine{baseDir: baseDir, lock: sync.Mutex{}}
-	err := eng.createDirectories(baseDir)
-	return &eng, err
+	baseDir := filepath.Clean(basePath)
+	if err := os.MkdirAll(baseDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := removeTempFiles(baseDir); err != nil {
+		return nil, err
+	}
+	sharding, err := readLayout(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{baseDir: baseDir, sharding: sharding, lock: sync.Mutex{}}, nil
 }
 
-type NoPathError string
+// NewShardedEngine opens the engine with the sharding, which is recorded for a new store. Fails when records of the
+// directory are stored with a different one, Relayout moves them.
+func NewShardedEngine(basePath string, sharding Sharding) (engine.Engine, error) {
+	if err := sharding.Validate(); err != nil {
+		return nil, err
+	}
+	baseDir := filepath.Clean(basePath)
+	if err := os.MkdirAll(baseDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := removeTempFiles(baseDir); err != nil {
+		return nil, err
+	}
+	stored, err := readLayout(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	if stored != sharding {
+		records, err := walkFiles(baseDir)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 || stored.Levels > 0 {
+			return nil, fmt.Errorf("records of %s are stored with %d shard levels, relayout the store to change it",
+				baseDir, stored.Levels)
+		}
+		if err := writeLayout(baseDir, sharding); err != nil {
+			return nil, err
+		}
+	}
+	return &Engine{baseDir: baseDir, sharding: sharding, lock: sync.Mutex{}}, nil
+}
 
-func (e NoPathError) Error() string {
-	return fmt.Sprintf("Path %s does not exist", string(e))
+// Relayout moves records of the directory to the sharding. Records already moved are recognized, so an interrupted
+// relayout continues when run again. Engines must not use the directory meanwhile.
+func Relayout(basePath string, sharding Sharding) (moved int, err error) {
+	if err := sharding.Validate(); err != nil {
+		return 0, err
+	}
+	baseDir := filepath.Clean(basePath)
+	if err := os.MkdirAll(baseDir, os.ModePerm); err != nil {
+		return 0, err
+	}
+	previous, err := readLayout(baseDir)
+	if err != nil {
+		return 0, err
+	}
+	if moved, err = relayout(baseDir, previous, sharding); err != nil {
+		return moved, fmt.Errorf("can't move records to the new layout: %w", err)
+	}
+	logging.With(logging.Fields{"stage": "engine", "engine": "file"}).
+		Printf("[INFO] Moved %d records from %d to %d shard levels", moved, previous.Levels, sharding.Levels)
+	return moved, writeLayout(baseDir, sharding)
 }
 
 func (e *Engine) Read(path string) ([]byte, error) {
 	e.lock.Lock()
 	defer e.lock.Unlock()
 
-	exists, err := e.Exists(path)
+	p, err := e.concatPath(path)
+	if err != nil {
+		return make([]byte, 0), err
+	}
+	exists, err := e.exists(p)
 	if err != nil {
 		return make([]byte, 0), err
 	}
 	if !exists {
-		return make([]byte, 0), NoPathError(path)
+		return make([]byte, 0), engine.NotFound(path)
 	}
 
-	return ioutil.ReadFile(e.concatPath(path))
+	return ioutil.ReadFile(p)
 }
 
 func (e *Engine) Write(path string, bytes []byte) error {
 	e.lock.Lock()
 	defer e.lock.Unlock()
-	err := ioutil.WriteFile(e.concatPath(path), bytes, filePermission)
-	return err
+
+	p, err := e.concatPath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	return writeAtomic(p, bytes)
 }
 
 func (e *Engine) Exists(path string) (bool, error) {
 	e.lock.Lock()
 	defer e.lock.Unlock()
 
-	return e.exists(e.concatPath(path))
+	p, err := e.concatPath(path)
+	if err != nil {
+		return false, err
+	}
+	return e.exists(p)
 }
 
-func (e *Engine) createDirectories(path string) error {
+func (e *Engine) List(prefix string) ([]string, error) {
 	e.lock.Lock()
 	defer e.lock.Unlock()
 
-	if _, err := os.Stat(e.concatPath(path)); os.IsNotExist(err) {
-		return os.Mkdir(path, os.ModePerm)
+	var paths []string
+	stored, err := walkFiles(e.baseDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range stored {
+		key, _ := e.sharding.unshard(p)
+		if strings.HasPrefix(key, prefix) {
+			paths = append(paths, key)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (e *Engine) Delete(path string) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	p, err := e.concatPath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeAtomic writes the file so it either keeps previous content or has the new one, even if the process crashes.
+// Content is written to a temporary file in the same directory, synced and renamed, then the directory is synced
+// to persist the rename.
+func writeAtomic(path string, b []byte) (err error) {
+	dir, name := filepath.Split(path)
+	tmp, err := ioutil.TempFile(dir, tempFilePrefix+name+tempFileMarker)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), filePermission); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// removeTempFiles removes temporary files of writes interrupted by a crash. Engines are opened before writing, so
+// no write of the process is in progress.
+func removeTempFiles(baseDir string) error {
+	removed := 0
+	err := filepath.Walk(baseDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasPrefix(info.Name(), tempFilePrefix) || !strings.Contains(info.Name(), tempFileMarker) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("can't remove temporary files: %w", err)
+	}
+	if removed > 0 {
+		logging.With(logging.Fields{"stage": "engine", "engine": "file"}).
+			Printf("[INFO] Removed %d temporary files of interrupted writes", removed)
 	}
 	return nil
 }
 
-func (e *Engine) concatPath(path string) string {
-	return e.baseDir + "/" + path
+func syncDir(dir string) error {
+	d, err := os.Open(filepath.Clean(dir))
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+// concatPath returns the file the record is stored in, records outside of the base directory are rejected
+func (e *Engine) concatPath(key string) (string, error) {
+	clean := path.Clean("/" + key)[1:]
+	if clean == "" || clean != strings.TrimPrefix(key, "/") {
+		return "", fmt.Errorf("invalid record path %q", key)
+	}
+	return filepath.Join(e.baseDir, filepath.FromSlash(e.sharding.shard(clean))), nil
 }
 
 func (e *Engine) exists(path string) (bool, error) {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
 		return false, nil
 	}
+	if err != nil {
+		return false, err
+	}
 	return true, nil
 }
@@ -0,0 +1,211 @@
+package file
+
+import (
+	"errors"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/enginetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngine_Write(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	eng, err := NewSystemEngine(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, eng.Write("1.json", []byte("{\"id\":1}")))
+	require.NoError(t, eng.Write("1.json", []byte("{\"id\":1,\"name\":\"Wille Acme\"}")))
+
+	b, err := eng.Read("1.json")
+	require.NoError(t, err)
+	assert.Equal(t, "{\"id\":1,\"name\":\"Wille Acme\"}", string(b))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1, "temporary files are left")
+	assert.Equal(t, "1.json", files[0].Name())
+	assert.Equal(t, "-rw-r--r--", files[0].Mode().String())
+
+	_, err = eng.Read("2.json")
+	assert.True(t, errors.Is(err, engine.ErrNotFound))
+}
+
+func TestEngine_List_SkipsTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	eng, err := NewSystemEngine(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, eng.Write("1.json", []byte("{}")))
+	// a write interrupted by a crash leaves its temporary file behind
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".2.json.tmp-123"), []byte("{\"id\""), filePermission))
+
+	paths, err := eng.List("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.json"}, paths)
+}
+
+func TestEngine_RemovesTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	eng, err := NewSystemEngine(dir)
+	require.NoError(t, err)
+	require.NoError(t, eng.Write("offers/1.json", []byte("{}")))
+	// writes interrupted by a crash leave their temporary files behind
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".2.json.tmp-123"), []byte("{\"id\""), filePermission))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "offers", ".3.json.tmp-456"), []byte("{"), filePermission))
+
+	_, err = NewSystemEngine(dir)
+	require.NoError(t, err)
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "offers", files[0].Name())
+	files, err = ioutil.ReadDir(filepath.Join(dir, "offers"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "1.json", files[0].Name())
+
+	_, err = NewShardedEngine(dir, Sharding{})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".4.json.tmp-789"), []byte("{"), filePermission))
+	_, err = NewShardedEngine(dir, Sharding{})
+	require.NoError(t, err)
+	_, err = ioutil.ReadFile(filepath.Join(dir, ".4.json.tmp-789"))
+	assert.Error(t, err, "temporary file is removed by the sharded engine")
+}
+
+func TestEngine_Exists_StatError(t *testing.T) {
+	eng, err := NewSystemEngine(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, eng.Write("1.json", []byte("{}")))
+
+	// a record can't be nested under a file, stat fails with other error than not exists
+	exists, err := eng.Exists("1.json/2.json")
+	assert.Error(t, err)
+	assert.False(t, exists)
+
+	_, err = eng.Read("1.json/2.json")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, engine.ErrNotFound))
+}
+
+func TestEngine_NestedPaths(t *testing.T) {
+	dir := t.TempDir()
+	eng, err := NewSystemEngine(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, eng.Write("offers/ab/12345.json", []byte("{}")))
+	require.NoError(t, eng.Write("history/12345.json", []byte("[]")))
+	require.NoError(t, eng.Write("1.json", []byte("{}")))
+	assert.FileExists(t, filepath.Join(dir, "offers", "ab", "12345.json"))
+
+	exists, err := eng.Exists("history/12345.json")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	paths, err := eng.List("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.json", "history/12345.json", "offers/ab/12345.json"}, paths)
+
+	paths, err = eng.List("offers/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"offers/ab/12345.json"}, paths)
+
+	for _, p := range []string{"../1.json", "offers/../../1.json", "", "offers//1.json"} {
+		assert.Error(t, eng.Write(p, []byte("{}")), p)
+	}
+}
+
+func TestEngine_Sharding(t *testing.T) {
+	dir := t.TempDir()
+	flat, err := NewSystemEngine(dir)
+	require.NoError(t, err)
+	require.NoError(t, flat.Write("1.json", []byte("{\"id\":1}")))
+	require.NoError(t, flat.Write("offers/2.json", []byte("{\"id\":2}")))
+
+	sharding := Sharding{Levels: 2, Width: 2}
+	_, err = NewShardedEngine(dir, sharding)
+	assert.Error(t, err, "records are not moved by opening the store")
+
+	moved, err := Relayout(dir, sharding)
+	require.NoError(t, err)
+	assert.Equal(t, 2, moved)
+	stored, err := walkFiles(dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{sharding.shard("1.json"), sharding.shard("offers/2.json")}, stored)
+	assert.Regexp(t, "^offers/[0-9a-f]{2}/[0-9a-f]{2}/2.json$", sharding.shard("offers/2.json"))
+
+	// the store is opened with the layout of its records
+	for _, open := range []func() (engine.Engine, error){
+		func() (engine.Engine, error) { return NewSystemEngine(dir) },
+		func() (engine.Engine, error) { return NewShardedEngine(dir, sharding) },
+	} {
+		sharded, err := open()
+		require.NoError(t, err)
+		paths, err := sharded.List("")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1.json", "offers/2.json"}, paths)
+		b, err := sharded.Read("offers/2.json")
+		require.NoError(t, err)
+		assert.Equal(t, "{\"id\":2}", string(b))
+	}
+	_, err = NewShardedEngine(dir, Sharding{Levels: 1, Width: 2})
+	assert.Error(t, err)
+	stored, err = walkFiles(dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{sharding.shard("1.json"), sharding.shard("offers/2.json")}, stored)
+
+	// an interrupted relayout left a record in the flat layout
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "3.json"), []byte("{\"id\":3}"), filePermission))
+	require.NoError(t, writeLayout(dir, Sharding{}))
+	moved, err = Relayout(dir, sharding)
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+
+	// back to the flat layout, empty shard directories are removed
+	_, err = Relayout(dir, Sharding{})
+	require.NoError(t, err)
+	stored, err = walkFiles(dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1.json", "3.json", "offers/2.json"}, stored)
+	files, err := ioutil.ReadDir(filepath.Join(dir, "offers"))
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	_, err = NewShardedEngine(dir, Sharding{Levels: 1, Width: 0})
+	assert.Error(t, err)
+	_, err = Relayout(dir, Sharding{Levels: 1, Width: 0})
+	assert.Error(t, err)
+}
+
+func TestEngine_NewShardedEngine_NewStore(t *testing.T) {
+	dir := t.TempDir()
+	sharded, err := NewShardedEngine(dir, Sharding{Levels: 1, Width: 2})
+	require.NoError(t, err)
+	require.NoError(t, sharded.Write("1.json", []byte("{}")))
+	assert.NoFileExists(t, filepath.Join(dir, "1.json"))
+
+	eng, err := NewSystemEngine(dir)
+	require.NoError(t, err)
+	exists, err := eng.Exists("1.json")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestEngine_Conformance(t *testing.T) {
+	enginetest.Run(t, func(t *testing.T) engine.Engine {
+		eng, err := NewSystemEngine(t.TempDir())
+		require.NoError(t, err)
+		return eng
+	})
+	t.Run("sharded", func(t *testing.T) {
+		enginetest.Run(t, func(t *testing.T) engine.Engine {
+			eng, err := NewShardedEngine(t.TempDir(), Sharding{Levels: 2, Width: 1})
+			require.NoError(t, err)
+			return eng
+		})
+	})
+}
@@ -0,0 +1,170 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// layoutFileName keeps the sharding records were written with, it is hidden from List as a temporary file
+const layoutFileName = tempFilePrefix + "layout.json"
+
+// Sharding spreads records of a directory over nested directories named after the hash of the record name, e.g.
+// offers/12345.json is stored as offers/5d/12345.json with one level of two characters. Zero levels keep the flat
+// layout.
+type Sharding struct {
+	Levels int `json:"levels"`
+	Width  int `json:"width"`
+}
+
+// Validate checks the sharding creates at most 4 levels of at most 4 characters each
+func (s Sharding) Validate() error {
+	if s.Levels < 0 || s.Levels > 4 {
+		return fmt.Errorf("shard levels must be between 0 and 4, got %d", s.Levels)
+	}
+	if s.Levels > 0 && (s.Width < 1 || s.Width > 4) {
+		return fmt.Errorf("shard width must be between 1 and 4, got %d", s.Width)
+	}
+	return nil
+}
+
+// shard returns the path the record is stored at
+func (s Sharding) shard(key string) string {
+	if s.Levels == 0 {
+		return key
+	}
+	dir, name := path.Split(key)
+	return dir + strings.Join(s.directories(name), "/") + "/" + name
+}
+
+// unshard returns the record key of the stored path, reports false when the path is not sharded with the sharding
+func (s Sharding) unshard(stored string) (string, bool) {
+	if s.Levels == 0 {
+		return stored, true
+	}
+	parts := strings.Split(stored, "/")
+	if len(parts) <= s.Levels {
+		return stored, false
+	}
+	name := parts[len(parts)-1]
+	shards := parts[len(parts)-1-s.Levels : len(parts)-1]
+	for i, d := range s.directories(name) {
+		if shards[i] != d {
+			return stored, false
+		}
+	}
+	key := append([]string{}, parts[:len(parts)-1-s.Levels]...)
+	return strings.Join(append(key, name), "/"), true
+}
+
+func (s Sharding) directories(name string) []string {
+	sum := sha256.Sum256([]byte(name))
+	h := hex.EncodeToString(sum[:])
+	dirs := make([]string, 0, s.Levels)
+	for i := 0; i < s.Levels; i++ {
+		dirs = append(dirs, h[i*s.Width:(i+1)*s.Width])
+	}
+	return dirs
+}
+
+// readLayout returns sharding of the stored records, stores without the layout file are flat
+func readLayout(baseDir string) (Sharding, error) {
+	b, err := ioutil.ReadFile(filepath.Join(baseDir, layoutFileName))
+	if os.IsNotExist(err) {
+		return Sharding{}, nil
+	}
+	if err != nil {
+		return Sharding{}, err
+	}
+	var s Sharding
+	if err := json.Unmarshal(b, &s); err != nil {
+		return Sharding{}, fmt.Errorf("invalid layout file: %w", err)
+	}
+	return s, nil
+}
+
+func writeLayout(baseDir string, s Sharding) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(filepath.Join(baseDir, layoutFileName), b)
+}
+
+// relayout moves records stored with the previous sharding to paths of the current one, records already moved are
+// recognized
+func relayout(baseDir string, previous Sharding, current Sharding) (moved int, err error) {
+	stored, err := walkFiles(baseDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range stored {
+		if _, ok := current.unshard(p); ok && current.Levels > 0 {
+			continue
+		}
+		key, ok := previous.unshard(p)
+		if !ok {
+			key = p
+		}
+		target := current.shard(key)
+		if target == p {
+			continue
+		}
+		targetPath := filepath.Join(baseDir, filepath.FromSlash(target))
+		if err := os.MkdirAll(filepath.Dir(targetPath), os.ModePerm); err != nil {
+			return moved, err
+		}
+		sourcePath := filepath.Join(baseDir, filepath.FromSlash(p))
+		if err := os.Rename(sourcePath, targetPath); err != nil {
+			return moved, err
+		}
+		removeEmptyDirs(baseDir, filepath.Dir(sourcePath))
+		moved++
+	}
+	return moved, nil
+}
+
+// walkFiles returns slash separated paths of all files under the directory, hidden files and directories are skipped
+func walkFiles(baseDir string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(baseDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == baseDir {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), tempFilePrefix) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	return paths, err
+}
+
+// removeEmptyDirs removes the directory and its parents up to the base directory while they are empty
+func removeEmptyDirs(baseDir string, dir string) {
+	for dir != baseDir && strings.HasPrefix(dir, baseDir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,174 @@
+package memory
+
+import (
+	"encoding/json"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/logging"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Engine keeps records in memory, optionally loading them from a snapshot file on start and writing them back with
+// Snapshot, e.g. after every run
+type Engine struct {
+	lock    sync.RWMutex
+	records map[string][]byte
+	// snapshot is the file records are loaded from and written to, records are lost on exit when not set
+	snapshot string
+}
+
+func NewEngine() *Engine {
+	return NewEngineWith(map[string][]byte{})
+}
+
+// NewEngineWith creates the engine with the records, useful to set up a state in tests
+func NewEngineWith(records map[string][]byte) *Engine {
+	copied := make(map[string][]byte, len(records))
+	for path, b := range records {
+		copied[path] = append([]byte{}, b...)
+	}
+	return &Engine{records: copied}
+}
+
+// NewSnapshotEngine creates the engine with records of the snapshot file, the file is created by the first Snapshot
+// when it doesn't exist
+func NewSnapshotEngine(snapshot string) (*Engine, error) {
+	records := map[string][]byte{}
+	b, err := ioutil.ReadFile(snapshot)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &records); err != nil {
+			return nil, err
+		}
+	}
+	logging.With(logging.Fields{"stage": "engine", "engine": "memory", "path": snapshot}).
+		Printf("[DEBUG] Loaded %d records from snapshot", len(records))
+	return &Engine{records: records, snapshot: snapshot}, nil
+}
+
+func (e *Engine) Read(path string) ([]byte, error) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	b, ok := e.records[path]
+	if !ok {
+		return make([]byte, 0), engine.NotFound(path)
+	}
+	return append([]byte{}, b...), nil
+}
+
+func (e *Engine) Write(path string, b []byte) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.records[path] = append([]byte{}, b...)
+	return nil
+}
+
+func (e *Engine) Exists(path string) (bool, error) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	_, ok := e.records[path]
+	return ok, nil
+}
+
+func (e *Engine) List(prefix string) ([]string, error) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	var paths []string
+	for path := range e.records {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (e *Engine) Delete(path string) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	delete(e.records, path)
+	return nil
+}
+
+// Records returns a copy of all records by their paths
+func (e *Engine) Records() map[string][]byte {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	records := make(map[string][]byte, len(e.records))
+	for path, b := range e.records {
+		records[path] = append([]byte{}, b...)
+	}
+	return records
+}
+
+// Snapshot writes all records to the snapshot file replacing it at once, does nothing without the file
+func (e *Engine) Snapshot() error {
+	if e.snapshot == "" {
+		return nil
+	}
+	e.lock.RLock()
+	b, err := json.Marshal(e.records)
+	count := len(e.records)
+	e.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	dir, name := filepath.Split(e.snapshot)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, "."+name+".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), e.snapshot); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+	logging.With(logging.Fields{"stage": "engine", "engine": "memory", "path": e.snapshot}).
+		Printf("[DEBUG] Saved %d records to snapshot", count)
+	return nil
+}
+
+// syncDir flushes the rename of the snapshot file to disk
+func syncDir(dir string) error {
+	d, err := os.Open(filepath.Clean(dir))
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return err
+	}
+	return d.Close()
+}
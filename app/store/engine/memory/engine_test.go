@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/enginetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngine_Conformance(t *testing.T) {
+	enginetest.Run(t, func(t *testing.T) engine.Engine {
+		return NewEngine()
+	})
+}
+
+func TestEngine_Snapshot(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "state.json")
+
+	eng, err := NewSnapshotEngine(snapshot)
+	require.NoError(t, err)
+	require.NoError(t, eng.Write("1.json", []byte("{\"id\":1}")))
+	require.NoError(t, eng.Write("images/abc", []byte{0xff, 0xd8}))
+	require.NoError(t, eng.Snapshot())
+
+	loaded, err := NewSnapshotEngine(snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, eng.Records(), loaded.Records())
+
+	files, err := ioutil.ReadDir(filepath.Dir(snapshot))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "temporary files are left")
+
+	require.NoError(t, ioutil.WriteFile(snapshot, []byte("{\"1.json\""), 0644))
+	_, err = NewSnapshotEngine(snapshot)
+	assert.Error(t, err)
+
+	assert.NoError(t, NewEngine().Snapshot())
+}
+
+func TestEngine_Read_ReturnsCopy(t *testing.T) {
+	eng := NewEngineWith(map[string][]byte{"1.json": []byte("{}")})
+
+	b, err := eng.Read("1.json")
+	require.NoError(t, err)
+	b[0] = '['
+
+	b, err = eng.Read("1.json")
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(b))
+}
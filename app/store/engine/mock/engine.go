@@ -2,7 +2,6 @@ package mock
 
 import (
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
-	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/file"
 )
 
 type Engine struct {
@@ -13,7 +12,7 @@ func NewEngine() engine.Engine {
 }
 
 func (e Engine) Read(path string) ([]byte, error) {
-	return make([]byte, 0), file.NoPathError(path)
+	return make([]byte, 0), engine.NotFound(path)
 }
 
 func (e Engine) Write(_ string, _ []byte) error {
@@ -23,3 +22,11 @@ func (e Engine) Write(_ string, _ []byte) error {
 func (e Engine) Exists(_ string) (bool, error) {
 	return false, nil
 }
+
+func (e Engine) List(_ string) ([]string, error) {
+	return nil, nil
+}
+
+func (e Engine) Delete(_ string) error {
+	return nil
+}
@@ -0,0 +1,14 @@
+package mock
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/enginetest"
+	"testing"
+)
+
+// The engine discards writes, so only reads of missing records are checked
+func TestEngine_Conformance(t *testing.T) {
+	enginetest.RunMissing(t, func(t *testing.T) engine.Engine {
+		return NewEngine()
+	})
+}
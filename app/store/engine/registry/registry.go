@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/file"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/s3"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Open creates an engine described by the url:
+//
+//	file:///var/lib/state or a plain path opens the file engine in the directory with the layout of its records,
+//	file:///var/lib/state?shard-levels=1&shard-width=2 creates a new store with sharding, the width defaults to 2
+//	s3://bucket?region=eu-west-1&endpoint=http://localhost:9000 opens the s3 engine, endpoint is optional
+func Open(rawUrl string) (engine.Engine, error) {
+	if !strings.Contains(rawUrl, "://") {
+		return file.NewSystemEngine(rawUrl)
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid engine url %q: %w", rawUrl, err)
+	}
+	switch u.Scheme {
+	case "file":
+		path := u.Host + u.Path
+		if path == "" {
+			return nil, fmt.Errorf("engine url %q has no path", rawUrl)
+		}
+		if u.Query().Get("shard-levels") == "" {
+			return file.NewSystemEngine(path)
+		}
+		sharding, err := parseSharding(u.Query())
+		if err != nil {
+			return nil, fmt.Errorf("engine url %q: %w", rawUrl, err)
+		}
+		return file.NewShardedEngine(path, sharding)
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("engine url %q has no bucket", rawUrl)
+		}
+		region := u.Query().Get("region")
+		if region == "" {
+			return nil, fmt.Errorf("engine url %q has no region", rawUrl)
+		}
+		return s3.NewRegionEngine(u.Host, region, u.Query().Get("endpoint"))
+	default:
+		return nil, fmt.Errorf("engine url %q has unsupported scheme, supported are file and s3", rawUrl)
+	}
+}
+
+func parseSharding(q url.Values) (file.Sharding, error) {
+	sharding := file.Sharding{Width: 2}
+	if v := q.Get("shard-levels"); v != "" {
+		levels, err := strconv.Atoi(v)
+		if err != nil {
+			return sharding, fmt.Errorf("invalid shard levels: %w", err)
+		}
+		sharding.Levels = levels
+	}
+	if v := q.Get("shard-width"); v != "" {
+		width, err := strconv.Atoi(v)
+		if err != nil {
+			return sharding, fmt.Errorf("invalid shard width: %w", err)
+		}
+		sharding.Width = width
+	}
+	return sharding, nil
+}
@@ -0,0 +1,45 @@
+package registry
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	eng, err := Open("file://" + filepath.Join(dir, "state"))
+	require.NoError(t, err)
+	require.NoError(t, eng.Write("1.json", []byte("{}")))
+	assert.FileExists(t, filepath.Join(dir, "state", "1.json"))
+
+	_, err = Open(filepath.Join(dir, "plain"))
+	require.NoError(t, err)
+	assert.DirExists(t, filepath.Join(dir, "plain"))
+
+	eng, err = Open("file://" + filepath.Join(dir, "sharded") + "?shard-levels=1")
+	require.NoError(t, err)
+	require.NoError(t, eng.Write("1.json", []byte("{}")))
+	paths, err := eng.List("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.json"}, paths)
+	assert.NoFileExists(t, filepath.Join(dir, "sharded", "1.json"))
+
+	// a plain path opens the store with the layout of its records, e.g. the source of migrate
+	eng, err = Open(filepath.Join(dir, "sharded"))
+	require.NoError(t, err)
+	paths, err = eng.List("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.json"}, paths)
+	assert.NoFileExists(t, filepath.Join(dir, "sharded", "1.json"))
+
+	_, err = Open("s3://offer-updates?region=eu-west-1&endpoint=http://localhost:9000")
+	require.NoError(t, err)
+
+	for _, u := range []string{"s3://offer-updates", "s3://?region=eu-west-1", "file://", "sqlite:///state.db", "file://%zz", "file:///tmp/state?shard-levels=x", "file:///tmp/state?shard-levels=9"} {
+		_, err = Open(u)
+		assert.Error(t, err, u)
+	}
+}
@@ -2,15 +2,19 @@ package s3
 
 import (
 	"bytes"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
-	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/file"
 	"io/ioutil"
 )
 
 var contentType = "application/json"
 
+// errCodeNotFound is the code of HeadObject errors of missing keys
+const errCodeNotFound = "NotFound"
+
 type Engine struct {
 	bucket string
 	s3     *s3.S3
@@ -21,6 +25,22 @@ func NewEngine(bucket string, svc *s3.S3) (engine.Engine, error) {
 	return eng, nil
 }
 
+// NewRegionEngine creates an engine with a new session of the region, endpoint is set for s3-like storages and
+// makes requests use path style addressing without ssl
+func NewRegionEngine(bucket string, region string, endpoint string) (engine.Engine, error) {
+	cfg := &aws.Config{Region: aws.String(region)}
+	if endpoint != "" {
+		cfg.Endpoint = aws.String(endpoint)
+		cfg.DisableSSL = aws.Bool(true)
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewEngine(bucket, s3.New(sess))
+}
+
 func (e *Engine) Read(path string) ([]byte, error) {
 	obj, err := e.s3.GetObject(&s3.GetObjectInput{
 		Bucket: &e.bucket,
@@ -30,7 +50,7 @@ func (e *Engine) Read(path string) ([]byte, error) {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case s3.ErrCodeNoSuchKey:
-				return make([]byte, 0), file.NoPathError(aerr.Message())
+				return make([]byte, 0), engine.NotFound(path)
 			default:
 				return make([]byte, 0), err
 			}
@@ -59,14 +79,34 @@ func (e *Engine) Exists(path string) (bool, error) {
 		Key:    &path,
 	})
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case s3.ErrCodeNoSuchKey:
-				return false, nil
-			default:
-				return false, err
-			}
+		// HEAD responses have no body, so the missing key is reported with the status code only
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == errCodeNotFound || aerr.Code() == s3.ErrCodeNoSuchKey) {
+			return false, nil
 		}
+		return false, err
 	}
 	return true, nil
 }
+
+// Delete removes the object, S3 doesn't report missing keys on delete
+func (e *Engine) Delete(path string) error {
+	_, err := e.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: &e.bucket,
+		Key:    &path,
+	})
+	return err
+}
+
+func (e *Engine) List(prefix string) ([]string, error) {
+	var paths []string
+	err := e.s3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: &e.bucket,
+		Prefix: &prefix,
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			paths = append(paths, *obj.Key)
+		}
+		return true
+	})
+	return paths, err
+}
@@ -0,0 +1,137 @@
+package s3
+
+import (
+	"encoding/xml"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine/enginetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const bucket = "offer-updates"
+
+func TestEngine_Conformance(t *testing.T) {
+	enginetest.Run(t, func(t *testing.T) engine.Engine {
+		server := httptest.NewServer(newFakeS3())
+		t.Cleanup(server.Close)
+		return newTestEngine(t, server.URL)
+	})
+}
+
+func TestEngine_Exists_Failure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	eng := newTestEngine(t, server.URL)
+
+	exists, err := eng.Exists("1.json")
+	assert.Error(t, err)
+	assert.False(t, exists)
+
+	server.Close()
+	exists, err = eng.Exists("1.json")
+	assert.Error(t, err)
+	assert.False(t, exists)
+}
+
+func newTestEngine(t *testing.T, endpoint string) engine.Engine {
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("eu-west-1"),
+		Endpoint:         aws.String(endpoint),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+		DisableSSL:       aws.Bool(true),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	})
+	require.NoError(t, err)
+	eng, err := NewEngine(bucket, s3.New(sess))
+	require.NoError(t, err)
+	return eng
+}
+
+// fakeS3 serves objects of a single bucket the way S3 does for path style requests: GetObject of a missing key
+// responds with NoSuchKey, HeadObject with a bare 404 status, DeleteObject succeeds for missing keys
+type fakeS3 struct {
+	m       sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if r.URL.Path == "/"+bucket || r.URL.Path == "/"+bucket+"/" {
+		f.list(w, r.URL.Query().Get("prefix"))
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/"+bucket+"/")
+	switch r.Method {
+	case http.MethodPut:
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.objects[key] = b
+	case http.MethodHead:
+		if _, ok := f.objects[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case http.MethodGet:
+		b, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>"))
+			return
+		}
+		_, _ = w.Write(b)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key string
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []content
+	}{Name: bucket, Prefix: prefix}
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result.Contents = append(result.Contents, content{Key: key})
+	}
+	result.KeyCount = len(keys)
+	_ = xml.NewEncoder(w).Encode(result)
+}
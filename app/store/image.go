@@ -0,0 +1,146 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"strings"
+	"time"
+)
+
+// imagesPrefix keeps cached images apart from offer records
+const imagesPrefix = "images/"
+
+const contentPrefix = imagesPrefix + "content-"
+
+// Image describes cached image content fetched from the url
+type Image struct {
+	Url          string    `json:"url"`
+	Hash         string    `json:"hash"`
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+type ImageStore interface {
+	// Get returns image description cached for the url
+	Get(url string) (Image, error)
+
+	// GetContent returns image bytes stored under the content hash
+	GetContent(hash string) ([]byte, error)
+
+	// Save stores image description and its content, content is shared between images with the same hash
+	Save(image Image, content []byte) error
+
+	// Prune removes images fetched before the time and content no remaining image refers to, returns the number of
+	// removed records
+	Prune(before time.Time) (int, error)
+}
+
+func NewImageFileStore(engine engine.Engine) ImageStore {
+	return &ImageFileStore{engine: engine}
+}
+
+type ImageFileStore struct {
+	engine engine.Engine
+}
+
+// NewReadOnlyImageStore creates a store reading cached images of the underlying store and dropping saved ones, so
+// a dry run doesn't touch the engine
+func NewReadOnlyImageStore(images ImageStore) ImageStore {
+	return &readOnlyImageStore{ImageStore: images}
+}
+
+type readOnlyImageStore struct {
+	ImageStore
+}
+
+func (s *readOnlyImageStore) Save(_ Image, _ []byte) error {
+	return nil
+}
+
+func (s *readOnlyImageStore) Prune(_ time.Time) (int, error) {
+	return 0, nil
+}
+
+func (f *ImageFileStore) Get(url string) (Image, error) {
+	b, err := f.engine.Read(f.fileName(url))
+	if err != nil {
+		return Image{}, err
+	}
+	var image Image
+	err = json.Unmarshal(b, &image)
+	return image, err
+}
+
+func (f *ImageFileStore) GetContent(hash string) ([]byte, error) {
+	return f.engine.Read(f.contentFileName(hash))
+}
+
+func (f *ImageFileStore) Save(image Image, content []byte) error {
+	exists, err := f.engine.Exists(f.contentFileName(image.Hash))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err = f.engine.Write(f.contentFileName(image.Hash), content); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(image)
+	if err != nil {
+		return err
+	}
+	return f.engine.Write(f.fileName(image.Url), b)
+}
+
+func (f *ImageFileStore) Prune(before time.Time) (int, error) {
+	paths, err := f.engine.List(imagesPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	referenced := map[string]bool{}
+	for _, p := range paths {
+		if strings.HasPrefix(p, contentPrefix) {
+			continue
+		}
+		b, err := f.engine.Read(p)
+		if err != nil {
+			return removed, err
+		}
+		var image Image
+		// unreadable records can't be served from the cache either
+		if err := json.Unmarshal(b, &image); err == nil && !image.FetchedAt.Before(before) {
+			referenced[image.Hash] = true
+			continue
+		}
+		if err := f.engine.Delete(p); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	for _, p := range paths {
+		if !strings.HasPrefix(p, contentPrefix) || referenced[strings.TrimPrefix(p, contentPrefix)] {
+			continue
+		}
+		if err := f.engine.Delete(p); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (f *ImageFileStore) fileName(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return imagesPrefix + hex.EncodeToString(hash[:]) + ".json"
+}
+
+func (f *ImageFileStore) contentFileName(hash string) string {
+	return contentPrefix + hash
+}
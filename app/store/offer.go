@@ -3,11 +3,35 @@ package store
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// offerFileName matches names of offer files without a prefix, e.g. 123.json
+var offerFileName = regexp.MustCompile(`^[0-9]+\.json$`)
+
+// quarantinePrefix starts names of corrupted offer records set aside by quarantine
+const quarantinePrefix = "quarantine-"
+
+// CorruptedRecordError is returned when a stored record exists but can't be decoded, e.g. it was truncated
+type CorruptedRecordError struct {
+	Path string
+	Err  error
+}
+
+func (e *CorruptedRecordError) Error() string {
+	return fmt.Sprintf("record %s is corrupted: %v", e.Path, e.Err)
+}
+
+func (e *CorruptedRecordError) Unwrap() error {
+	return e.Err
+}
+
 type Offer struct {
 	Id            int64     `json:"id"`
 	Slug          string    `json:"slug"`
@@ -21,6 +45,43 @@ type Offer struct {
 	PriceMax      int64     `json:"price_max"`
 	AreaMin       int       `json:"area_min"`
 	AreaMax       int       `json:"area_max"`
+	// NotificationRef references the first notification sent about the offer
+	NotificationRef string `json:"notification_ref,omitempty"`
+	// MainImageHash is a hash of main image content, used to detect image changes
+	MainImageHash string `json:"main_image_hash,omitempty"`
+	// Details is the full investment record, fetched for new offers when enabled
+	Details   *OfferDetails `json:"details,omitempty"`
+	Latitude  float64       `json:"latitude,omitempty"`
+	Longitude float64       `json:"longitude,omitempty"`
+	// Neighbourhood is the name of the filter polygon the offer is inside, shown in new offer notifications and
+	// exports only
+	Neighbourhood string `json:"neighbourhood,omitempty"`
+	// PriceHistory records price and area ranges every time they changed, oldest first
+	PriceHistory []PriceRecord `json:"price_history,omitempty"`
+}
+
+// PriceRecord is price and area ranges of the offer observed at the time
+type PriceRecord struct {
+	At       time.Time `json:"at"`
+	PriceMin int64     `json:"price_min"`
+	PriceMax int64     `json:"price_max"`
+	AreaMin  int       `json:"area_min"`
+	AreaMax  int       `json:"area_max"`
+}
+
+// OfferDetails is the full investment record of the offer
+type OfferDetails struct {
+	Address           string    `json:"address,omitempty"`
+	Latitude          float64   `json:"latitude,omitempty"`
+	Longitude         float64   `json:"longitude,omitempty"`
+	ConstructionStart string    `json:"construction_start,omitempty"`
+	ConstructionEnd   string    `json:"construction_end,omitempty"`
+	PropertiesCount   int       `json:"properties_count,omitempty"`
+	Amenities         []string  `json:"amenities,omitempty"`
+	Description       string    `json:"description,omitempty"`
+	VendorName        string    `json:"vendor_name,omitempty"`
+	Gallery           []string  `json:"gallery,omitempty"`
+	FetchedAt         time.Time `json:"fetched_at"`
 }
 
 func (t *Offer) CompareAveragePrices(o Offer) int {
@@ -34,10 +95,58 @@ func (t *Offer) CompareAveragePrices(o Offer) int {
 	return 0
 }
 
+// History returns recorded prices of the offer, offers stored before prices were recorded have the current
+// price observed at import time
+func (t *Offer) History() []PriceRecord {
+	if len(t.PriceHistory) > 0 {
+		return t.PriceHistory
+	}
+	return []PriceRecord{t.priceRecord(t.ImportedAt)}
+}
+
+// RecordPrice appends current price and area ranges to the history when they differ from the last record
+func (t *Offer) RecordPrice(at time.Time) {
+	record := t.priceRecord(at)
+	if n := len(t.PriceHistory); n > 0 {
+		last := t.PriceHistory[n-1]
+		last.At = at
+		if last == record {
+			return
+		}
+	}
+	t.PriceHistory = append(t.PriceHistory, record)
+}
+
+// Coordinates returns coordinates of the listing, falling back to ones of details, ok is false when both are unknown
+func (t *Offer) Coordinates() (latitude float64, longitude float64, ok bool) {
+	if t.Latitude != 0 || t.Longitude != 0 {
+		return t.Latitude, t.Longitude, true
+	}
+	if t.Details != nil && (t.Details.Latitude != 0 || t.Details.Longitude != 0) {
+		return t.Details.Latitude, t.Details.Longitude, true
+	}
+	return 0, 0, false
+}
+
+func (t *Offer) priceRecord(at time.Time) PriceRecord {
+	return PriceRecord{At: at, PriceMin: t.PriceMin, PriceMax: t.PriceMax, AreaMin: t.AreaMin, AreaMax: t.AreaMax}
+}
+
 type OfferStore interface {
 	Save(offer Offer) error
 
 	Get(offerId int64) (Offer, error)
+
+	// List returns all stored offers, fails on the first corrupted record
+	List() ([]Offer, error)
+
+	// Walk calls fn for every stored offer reading them one by one, stops on the first error returned by fn or
+	// the engine. Records which can't be decoded are passed to fn as *CorruptedRecordError, so fn can skip them.
+	Walk(fn func(offer Offer, err error) error) error
+
+	// Quarantine copies the corrupted record of the offer aside, so it can be inspected after the next save
+	// replaces it
+	Quarantine(offerId int64) error
 }
 
 func NewOfferFileStore(engine engine.Engine) OfferStore {
@@ -45,16 +154,38 @@ func NewOfferFileStore(engine engine.Engine) OfferStore {
 	return &fileStore
 }
 
+// NewPrefixedOfferFileStore creates a store keeping offers in files with the prefix, so several stores can share
+// the engine
+func NewPrefixedOfferFileStore(engine engine.Engine, prefix string) OfferStore {
+	fileStore := OfferFileStore{engine: engine, prefix: prefix}
+	return &fileStore
+}
+
+// NewFallbackOfferFileStore creates a prefixed store which reads offers not saved with the prefix yet from files
+// without the prefix, so offers stored before the prefix was introduced are known and move to prefixed files as they
+// are saved. Walk lists prefixed files only.
+func NewFallbackOfferFileStore(engine engine.Engine, prefix string) OfferStore {
+	fileStore := OfferFileStore{engine: engine, prefix: prefix, fallback: true}
+	return &fileStore
+}
+
 type OfferFileStore struct {
 	engine engine.Engine
+	prefix string
+	// fallback reads offers missing under the prefix from files without it
+	fallback bool
 }
 
 func (f *OfferFileStore) Get(offerId int64) (Offer, error) {
-	b, err := f.engine.Read(f.fileName(offerId))
+	fileName, b, err := f.read(offerId)
 	if err != nil {
 		return Offer{}, err
 	}
-	return f.deserialize(b)
+	offer, err := f.deserialize(b)
+	if err != nil {
+		return Offer{}, &CorruptedRecordError{Path: fileName, Err: err}
+	}
+	return offer, nil
 }
 
 func (f *OfferFileStore) Save(offer Offer) error {
@@ -67,8 +198,64 @@ func (f *OfferFileStore) Save(offer Offer) error {
 	return err
 }
 
+func (f *OfferFileStore) List() ([]Offer, error) {
+	var offers []Offer
+	err := f.Walk(func(offer Offer, err error) error {
+		if err != nil {
+			return err
+		}
+		offers = append(offers, offer)
+		return nil
+	})
+	return offers, err
+}
+
+func (f *OfferFileStore) Walk(fn func(offer Offer, err error) error) error {
+	paths, err := f.engine.List(f.prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if !offerFileName.MatchString(strings.TrimPrefix(path, f.prefix)) {
+			continue
+		}
+		b, err := f.engine.Read(path)
+		if err != nil {
+			return err
+		}
+		offer, err := f.deserialize(b)
+		if err != nil {
+			err = &CorruptedRecordError{Path: path, Err: err}
+		}
+		if err := fn(offer, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *OfferFileStore) Quarantine(offerId int64) error {
+	_, b, err := f.read(offerId)
+	if err != nil {
+		return err
+	}
+	return f.engine.Write(f.prefix+quarantinePrefix+strconv.FormatInt(offerId, 10)+".json", b)
+}
+
+// read reads the record of the offer, falling back to the file without the prefix when enabled
+func (f *OfferFileStore) read(offerId int64) (string, []byte, error) {
+	fileName := f.fileName(offerId)
+	b, err := f.engine.Read(fileName)
+	if f.fallback && errors.Is(err, engine.ErrNotFound) {
+		fileName = strconv.FormatInt(offerId, 10) + ".json"
+		b, err = f.engine.Read(fileName)
+	}
+	return fileName, b, err
+}
+
 func (f *OfferFileStore) fileName(offerId int64) string {
-	return strconv.FormatInt(offerId, 10) + ".json"
+	return f.prefix + strconv.FormatInt(offerId, 10) + ".json"
 }
 
 func (f *OfferFileStore) serialize(serializable interface{}) ([]byte, error) {
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/store/engine"
+	"strconv"
+)
+
+// Property statuses
+const (
+	PropertyAvailable = "available"
+	PropertyReserved  = "reserved"
+	PropertySold      = "sold"
+)
+
+// Property is a single unit, e.g. an apartment, of the offer
+type Property struct {
+	Id     int64   `json:"id"`
+	Number string  `json:"number,omitempty"`
+	Rooms  int     `json:"rooms"`
+	Floor  int     `json:"floor"`
+	Area   float64 `json:"area"`
+	Price  int64   `json:"price"`
+	Status string  `json:"status"`
+}
+
+type PropertyStore interface {
+	// Save replaces all stored properties of the offer
+	Save(offerId int64, properties []Property) error
+
+	Get(offerId int64) ([]Property, error)
+}
+
+func NewPropertyFileStore(engine engine.Engine) PropertyStore {
+	return &PropertyFileStore{engine: engine}
+}
+
+// NewPrefixedPropertyFileStore creates a store keeping properties in files with the prefix, so several stores can
+// share the engine
+func NewPrefixedPropertyFileStore(engine engine.Engine, prefix string) PropertyStore {
+	return &PropertyFileStore{engine: engine, prefix: prefix}
+}
+
+// NewFallbackPropertyFileStore creates a prefixed store which reads properties not saved with the prefix yet from
+// files without the prefix, as NewFallbackOfferFileStore does
+func NewFallbackPropertyFileStore(engine engine.Engine, prefix string) PropertyStore {
+	return &PropertyFileStore{engine: engine, prefix: prefix, fallback: true}
+}
+
+// PropertyFileStore keeps properties of an offer in a single file
+type PropertyFileStore struct {
+	engine engine.Engine
+	prefix string
+	// fallback reads properties missing under the prefix from files without it
+	fallback bool
+}
+
+func (f *PropertyFileStore) Get(offerId int64) ([]Property, error) {
+	b, err := f.engine.Read(f.fileName(offerId))
+	if f.fallback && errors.Is(err, engine.ErrNotFound) {
+		b, err = f.engine.Read("properties-" + strconv.FormatInt(offerId, 10) + ".json")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var properties []Property
+	err = json.Unmarshal(b, &properties)
+	return properties, err
+}
+
+func (f *PropertyFileStore) Save(offerId int64, properties []Property) error {
+	content, err := json.Marshal(properties)
+	if err != nil {
+		return err
+	}
+	return f.engine.Write(f.fileName(offerId), content)
+}
+
+func (f *PropertyFileStore) fileName(offerId int64) string {
+	return f.prefix + "properties-" + strconv.FormatInt(offerId, 10) + ".json"
+}
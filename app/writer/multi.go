@@ -0,0 +1,70 @@
+package writer
+
+import (
+	log "github.com/go-pkgz/lgr"
+	"go.uber.org/multierr"
+	"strings"
+)
+
+// refSeparator joins references of messages written by MultiWriter writers
+const refSeparator = ","
+
+// PartialError reports writers of MultiWriter which failed while others wrote the message
+type PartialError struct {
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	return "message written partially: " + e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// MultiWriter writes messages to all writers. The reference of written message joins references returned by writers
+// in writers order, so every writer gets its own reference in Message.ReplyTo.
+type MultiWriter []MessageWriter
+
+// Write fails when none of writers succeeded. When some of them failed the reference is returned along
+// with PartialError, so the message is not written again to writers which succeeded.
+func (m MultiWriter) Write(message Message) (string, error) {
+	replyTo := strings.Split(message.ReplyTo, refSeparator)
+	refs := make([]string, len(m))
+
+	var err error
+	written := 0
+	for i, w := range m {
+		msg := message
+		msg.ReplyTo = ""
+		if i < len(replyTo) {
+			msg.ReplyTo = replyTo[i]
+		}
+
+		ref, wErr := w.Write(msg)
+		if wErr != nil {
+			log.Printf("[WARN] Writer %d failed: %v", i, wErr)
+			err = multierr.Append(err, wErr)
+			continue
+		}
+		refs[i] = ref
+		written++
+	}
+	if written == 0 && len(m) > 0 {
+		return "", err
+	}
+	if err != nil {
+		return strings.Join(refs, refSeparator), &PartialError{Err: err}
+	}
+	return strings.Join(refs, refSeparator), nil
+}
+
+// AcceptsImageUrl reports true only when all writers accept image urls
+func (m MultiWriter) AcceptsImageUrl() bool {
+	for _, w := range m {
+		if rw, ok := w.(RemoteImageWriter); !ok || !rw.AcceptsImageUrl() {
+			return false
+		}
+	}
+	return len(m) > 0
+}
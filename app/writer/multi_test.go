@@ -0,0 +1,48 @@
+package writer
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMultiWriter_Write(t *testing.T) {
+	first := &recordingWriter{ref: "100:1"}
+	second := &recordingWriter{ref: "200:7"}
+	w := MultiWriter{first, second}
+
+	ref, err := w.Write(Message{Text: "🏡"})
+	require.NoError(t, err)
+	assert.Equal(t, "100:1,200:7", ref)
+
+	_, err = w.Write(Message{Text: "↘️", ReplyTo: ref})
+	require.NoError(t, err)
+	assert.Equal(t, "100:1", first.messages[1].ReplyTo)
+	assert.Equal(t, "200:7", second.messages[1].ReplyTo)
+}
+
+func TestMultiWriter_Write_PartialFailure(t *testing.T) {
+	w := MultiWriter{&recordingWriter{err: errors.New("down")}, &recordingWriter{ref: "200:7"}}
+
+	ref, err := w.Write(Message{Text: "🏡"})
+	var partial *PartialError
+	require.True(t, errors.As(err, &partial))
+	assert.EqualError(t, partial.Err, "down")
+	assert.Equal(t, ",200:7", ref)
+
+	w = MultiWriter{&recordingWriter{err: errors.New("down")}}
+	_, err = w.Write(Message{Text: "🏡"})
+	assert.EqualError(t, err, "down")
+}
+
+type recordingWriter struct {
+	ref      string
+	err      error
+	messages []Message
+}
+
+func (w *recordingWriter) Write(message Message) (string, error) {
+	w.messages = append(w.messages, message)
+	return w.ref, w.err
+}
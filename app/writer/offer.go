@@ -7,16 +7,26 @@ import (
 type Message struct {
 	Title string
 	Image []byte
-	Text  string
+	// ImageUrl is a link to the image for writers which accept remote images instead of uploaded bytes
+	ImageUrl string
+	Text     string
+	// ReplyTo is a reference returned by previous Write the message relates to
+	ReplyTo string
 }
 
 type MessageWriter interface {
-	Write(message Message) error
+	// Write sends the message and returns a reference to it which can be used in Message.ReplyTo
+	Write(message Message) (string, error)
+}
+
+// RemoteImageWriter is implemented by writers which are able to attach images by url
+type RemoteImageWriter interface {
+	AcceptsImageUrl() bool
 }
 
 type LogWriter struct{}
 
-func (l *LogWriter) Write(message Message) error {
+func (l *LogWriter) Write(message Message) (string, error) {
 	log.Printf("[INFO] Notifying message with title %v", message.Title)
-	return nil
+	return "", nil
 }
@@ -0,0 +1,35 @@
+package writer
+
+import (
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/media"
+	log "github.com/go-pkgz/lgr"
+)
+
+// ImageProcessingWriter processes message image according to the writer preferences before writing it
+type ImageProcessingWriter struct {
+	writer  MessageWriter
+	options media.ProcessOptions
+}
+
+func NewImageProcessingWriter(writer MessageWriter, options media.ProcessOptions) *ImageProcessingWriter {
+	return &ImageProcessingWriter{writer: writer, options: options}
+}
+
+func (w *ImageProcessingWriter) Write(message Message) (string, error) {
+	if len(message.Image) > 0 {
+		b, err := media.Process(message.Image, w.options)
+		if err != nil {
+			log.Printf("[WARN] Can't process image %v, writing it as is: %v", message.Title, err)
+		} else {
+			message.Image = b
+		}
+	}
+	return w.writer.Write(message)
+}
+
+func (w *ImageProcessingWriter) AcceptsImageUrl() bool {
+	if rw, ok := w.writer.(RemoteImageWriter); ok {
+		return rw.AcceptsImageUrl()
+	}
+	return false
+}
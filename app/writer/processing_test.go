@@ -0,0 +1,76 @@
+package writer
+
+import (
+	"bytes"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/media"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestImageProcessingWriter_Write_Resize(t *testing.T) {
+	target := &recordingWriter{ref: "100:1"}
+	w := NewImageProcessingWriter(target, media.ProcessOptions{MaxDimension: 100})
+
+	ref, err := w.Write(Message{Text: "🏡", Image: testPng(t, 400, 200)})
+	require.NoError(t, err)
+	assert.Equal(t, "100:1", ref)
+
+	require.Len(t, target.messages, 1)
+	img, format, err := image.Decode(bytes.NewReader(target.messages[0].Image))
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), img.Bounds())
+	assert.Equal(t, "🏡", target.messages[0].Text)
+}
+
+func TestImageProcessingWriter_Write_Format(t *testing.T) {
+	target := &recordingWriter{}
+	w := NewImageProcessingWriter(target, media.ProcessOptions{Format: media.FormatJpeg})
+
+	_, err := w.Write(Message{Text: "🏡", Image: testPng(t, 40, 80)})
+	require.NoError(t, err)
+
+	require.Len(t, target.messages, 1)
+	img, format, err := image.Decode(bytes.NewReader(target.messages[0].Image))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, image.Rect(0, 0, 40, 80), img.Bounds())
+}
+
+func TestImageProcessingWriter_Write_WithoutImage(t *testing.T) {
+	target := &recordingWriter{ref: "100:1"}
+	w := NewImageProcessingWriter(target, media.ProcessOptions{Format: media.FormatJpeg, MaxDimension: 100})
+
+	message := Message{Title: "Wille Acme", Text: "↘️", ReplyTo: "100:0"}
+	ref, err := w.Write(message)
+	require.NoError(t, err)
+	assert.Equal(t, "100:1", ref)
+	assert.Equal(t, []Message{message}, target.messages)
+}
+
+func TestImageProcessingWriter_Write_InvalidImage(t *testing.T) {
+	target := &recordingWriter{}
+	w := NewImageProcessingWriter(target, media.ProcessOptions{Format: media.FormatJpeg})
+
+	_, err := w.Write(Message{Text: "🏡", Image: []byte("<html></html>")})
+	require.NoError(t, err)
+
+	require.Len(t, target.messages, 1)
+	assert.Equal(t, []byte("<html></html>"), target.messages[0].Image, "image is written as is")
+}
+
+func testPng(t *testing.T, width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
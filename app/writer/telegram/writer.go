@@ -5,50 +5,121 @@ import (
 	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/writer"
 	log "github.com/go-pkgz/lgr"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"strconv"
+	"strings"
 )
 
+// replyNotFound is a part of the description telegram responds with when the replied message was deleted
+const replyNotFound = "reply message not found"
+
 type Writer struct {
 	ChatId int64
 	BotAPI *tgbotapi.BotAPI
+	// ImageByUrl lets telegram download images by itself instead of uploading them
+	ImageByUrl bool
 }
 
 func NewWriter(chatId int64, api *tgbotapi.BotAPI) *Writer {
 	return &Writer{ChatId: chatId, BotAPI: api}
 }
 
-func (w *Writer) Write(offer writer.Message) error {
-	if len(offer.Image) > 0 {
-		return w.photoUpload(offer)
+// Write sends the message with its image, or text only when the image is rejected so the notification isn't lost
+func (w *Writer) Write(offer writer.Message) (string, error) {
+	if len(offer.Image) > 0 || len(offer.ImageUrl) > 0 {
+		handler := w.photoShare
+		if len(offer.Image) > 0 {
+			handler = w.photoUpload
+		}
+		ref, err := w.send(offer, handler)
+		if err == nil || len(offer.Text) == 0 {
+			return ref, err
+		}
+		log.Printf("[WARN] Can't send message image, sending text only: %v", err)
+		// title names the image, text-only message must not show it
+		offer.Image, offer.ImageUrl, offer.Title = nil, "", ""
 	}
 	if len(offer.Text) > 0 {
-		return w.message(offer)
+		return w.send(offer, w.message)
+	}
+	return "", fmt.Errorf("no handler for %v", offer)
+}
+
+// send sends the message as a reply when possible and falls back to a standalone one when the replied message is gone
+func (w *Writer) send(offer writer.Message, handler func(writer.Message, int) (tgbotapi.Message, error)) (string, error) {
+	replyTo := w.messageId(offer.ReplyTo)
+	sent, err := handler(offer, replyTo)
+	if err != nil && replyTo != 0 && isReplyNotFound(err) {
+		log.Printf("[WARN] Message %v to reply to does not exist anymore, sending without reply..", replyTo)
+		sent, err = handler(offer, 0)
+	}
+	if err != nil {
+		return "", err
 	}
-	return fmt.Errorf("no handler for %v", offer)
+	return w.reference(sent.MessageID), nil
 }
 
-func (w *Writer) photoUpload(offer writer.Message) error {
+func (w *Writer) photoUpload(offer writer.Message, replyTo int) (tgbotapi.Message, error) {
 	image := tgbotapi.FileBytes{
 		Name:  offer.Title,
 		Bytes: offer.Image,
 	}
 	upload := tgbotapi.NewPhotoUpload(w.ChatId, image)
 	upload.Caption = offer.Text
+	upload.ReplyToMessageID = replyTo
 
 	log.Printf("[DEBUG] Uploading image %v..", upload)
 
-	_, err := w.BotAPI.Send(upload)
-	return err
+	return w.BotAPI.Send(upload)
+}
+
+func (w *Writer) AcceptsImageUrl() bool {
+	return w.ImageByUrl
+}
+
+func (w *Writer) photoShare(offer writer.Message, replyTo int) (tgbotapi.Message, error) {
+	share := tgbotapi.NewPhotoShare(w.ChatId, offer.ImageUrl)
+	share.Caption = offer.Text
+	share.ReplyToMessageID = replyTo
+
+	log.Printf("[DEBUG] Sharing image %v..", share)
+
+	return w.BotAPI.Send(share)
 }
 
-func (w *Writer) message(offer writer.Message) error {
+func (w *Writer) message(offer writer.Message, replyTo int) (tgbotapi.Message, error) {
 	txt := offer.Text
 	if len(offer.Title) > 0 {
 		txt = offer.Title + "\n\n" + txt
 	}
 	msg := tgbotapi.NewMessage(w.ChatId, txt)
+	msg.ReplyToMessageID = replyTo
 
 	log.Printf("[DEBUG] Sending text message %v..", msg)
 
-	_, err := w.BotAPI.Send(msg)
-	return err
+	return w.BotAPI.Send(msg)
+}
+
+// reference creates a reference to the sent message in format <chat id>:<message id>
+func (w *Writer) reference(messageId int) string {
+	return strconv.FormatInt(w.ChatId, 10) + ":" + strconv.Itoa(messageId)
+}
+
+// messageId extracts message id from the reference, returns 0 when the reference points to another chat or is invalid
+func (w *Writer) messageId(ref string) int {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 || parts[0] != strconv.FormatInt(w.ChatId, 10) {
+		return 0
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+func isReplyNotFound(err error) bool {
+	if tgErr, ok := err.(tgbotapi.Error); ok {
+		return strings.Contains(strings.ToLower(tgErr.Message), replyNotFound)
+	}
+	return strings.Contains(strings.ToLower(err.Error()), replyNotFound)
 }
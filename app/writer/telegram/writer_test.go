@@ -0,0 +1,140 @@
+package telegram
+
+import (
+	"fmt"
+	"github.com/butwhoareyou/rynek-pierwotny-updates-cli/writer"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestWriter_Write_ReplyTo(t *testing.T) {
+	var replies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		replies = append(replies, r.Form.Get("reply_to_message_id"))
+		_, _ = fmt.Fprint(w, "{\"ok\":true,\"result\":{\"message_id\":43}}")
+	}))
+	defer server.Close()
+	w := NewWriter(100, testBotAPI(server))
+
+	ref, err := w.Write(writer.Message{Text: "↘️ 950000-1150000", ReplyTo: "100:42"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "100:43", ref)
+	assert.Equal(t, []string{"42"}, replies)
+}
+
+func TestWriter_Write_ReplyToDeletedMessage(t *testing.T) {
+	var replies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		replyTo := r.Form.Get("reply_to_message_id")
+		replies = append(replies, replyTo)
+		if replyTo != "" {
+			_, _ = fmt.Fprint(w, "{\"ok\":false,\"error_code\":400,\"description\":\"Bad Request: reply message not found\"}")
+			return
+		}
+		_, _ = fmt.Fprint(w, "{\"ok\":true,\"result\":{\"message_id\":44}}")
+	}))
+	defer server.Close()
+	w := NewWriter(100, testBotAPI(server))
+
+	ref, err := w.Write(writer.Message{Text: "↘️ 950000-1150000", ReplyTo: "100:42"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "100:44", ref)
+	assert.Equal(t, []string{"42", ""}, replies)
+}
+
+func TestWriter_Write_ReplyToOtherChat(t *testing.T) {
+	var replies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		replies = append(replies, r.Form.Get("reply_to_message_id"))
+		_, _ = fmt.Fprint(w, "{\"ok\":true,\"result\":{\"message_id\":45}}")
+	}))
+	defer server.Close()
+	w := NewWriter(100, testBotAPI(server))
+
+	ref, err := w.Write(writer.Message{Text: "↗️ 1550000-1750000", ReplyTo: "200:42"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "100:45", ref)
+	assert.Equal(t, []string{""}, replies)
+}
+
+func TestWriter_Write_ImageUrlFallback(t *testing.T) {
+	var texts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if strings.HasSuffix(r.URL.Path, "/sendPhoto") {
+			_, _ = fmt.Fprint(w, "{\"ok\":false,\"error_code\":400,\"description\":\"Bad Request: wrong file identifier\"}")
+			return
+		}
+		texts = append(texts, r.Form.Get("text"))
+		_, _ = fmt.Fprint(w, "{\"ok\":true,\"result\":{\"message_id\":46}}")
+	}))
+	defer server.Close()
+	w := NewWriter(100, testBotAPI(server))
+	w.ImageByUrl = true
+
+	ref, err := w.Write(writer.Message{
+		Title:    "https://example.com/1.jpg",
+		ImageUrl: "https://example.com/1.jpg",
+		Text:     "🏡Wille Acme",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "100:46", ref)
+	assert.Equal(t, []string{"🏡Wille Acme"}, texts, "image url is not sent as text")
+}
+
+func TestWriter_Write_ImageUploadFallback(t *testing.T) {
+	var texts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/sendPhoto") {
+			_, _ = fmt.Fprint(w, "{\"ok\":false,\"error_code\":400,\"description\":\"Bad Request: IMAGE_PROCESS_FAILED\"}")
+			return
+		}
+		require.NoError(t, r.ParseForm())
+		texts = append(texts, r.Form.Get("text"))
+		_, _ = fmt.Fprint(w, "{\"ok\":true,\"result\":{\"message_id\":47}}")
+	}))
+	defer server.Close()
+	w := NewWriter(100, testBotAPI(server))
+
+	ref, err := w.Write(writer.Message{
+		Title: "https://example.com/1.jpg",
+		Image: []byte("<html></html>"),
+		Text:  "🏡Wille Acme",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "100:47", ref)
+	assert.Equal(t, []string{"🏡Wille Acme"}, texts, "rejected image is not sent as text")
+}
+
+func testBotAPI(server *httptest.Server) *tgbotapi.BotAPI {
+	serverUrl, _ := url.Parse(server.URL)
+	return &tgbotapi.BotAPI{
+		Token:  "token",
+		Client: &http.Client{Transport: rewriteTransport{host: serverUrl.Host}},
+	}
+}
+
+// rewriteTransport redirects all requests to the test server
+type rewriteTransport struct {
+	host string
+}
+
+func (t rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r.URL.Scheme = "http"
+	r.URL.Host = t.host
+	return http.DefaultTransport.RoundTrip(r)
+}